@@ -3,7 +3,10 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"runtime"
+	"strings"
+	"time"
 
 	"github.com/billy4479/server-tool/lib"
 	"github.com/urfave/cli/v2"
@@ -37,11 +40,111 @@ func gitProgressNil() func(string) {
 	return func(s string) {}
 }
 
+func divergenceResolverCLI(onDiverge string) (lib.DivergenceResolver, error) {
+	choice := lib.DivergenceAbort
+	switch onDiverge {
+	case "", "abort":
+		choice = lib.DivergenceAbort
+	case "remote":
+		choice = lib.DivergenceKeepRemote
+	case "branch":
+		choice = lib.DivergenceKeepLocalAsBranch
+	default:
+		return nil, fmt.Errorf("Invalid value %s for --on-diverge", onDiverge)
+	}
+
+	return func(ahead, behind int) (lib.DivergenceChoice, error) {
+		return choice, nil
+	}, nil
+}
+
+func findServerByName(name string) (*lib.Server, error) {
+	servers, err := lib.FindServers(&manifestProgressCLI{})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, s := range servers {
+		if s.Name == name {
+			return &s, nil
+		}
+	}
+	return nil, fmt.Errorf("Server %s not found", name)
+}
+
+var serverNameFlag = &cli.StringFlag{
+	Name:     "name",
+	Usage:    "Server name",
+	Aliases:  []string{"n"},
+	Required: true,
+}
+
+// confirmCLI asks a yes or no question, anything but yes is a no
+func confirmCLI(question string) (bool, error) {
+	fmt.Printf("%s [y/N] ", question)
+	answer, err := inputReader.ReadString('\n')
+	if err != nil && answer == "" {
+		return false, err
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
+
+func unfuckCommand(name string, usage string, kind lib.UnfuckKind, fn func(string) error) *cli.Command {
+	return &cli.Command{
+		Name:  name,
+		Usage: usage,
+		Flags: []cli.Flag{
+			serverNameFlag,
+			&cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "Only show what would change",
+			},
+			&cli.BoolFlag{
+				Name:    "yes",
+				Usage:   "Do not ask for confirmation",
+				Aliases: []string{"y"},
+			},
+		},
+		Action: func(ctx *cli.Context) error {
+			lib.L.Info.Printf("server-tool %s\n", lib.Version)
+			lib.DetectGitAndPrint()
+
+			s, err := findServerByName(ctx.String("name"))
+			if err != nil {
+				return err
+			}
+
+			preview, err := lib.PreviewUnfuck(s.BaseDir, kind)
+			if err != nil {
+				return err
+			}
+			fmt.Print(preview.String())
+
+			if ctx.Bool("dry-run") {
+				return nil
+			}
+			if !ctx.Bool("yes") {
+				ok, err := confirmCLI("Continue?")
+				if err != nil {
+					return err
+				}
+				if !ok {
+					lib.L.Info.Println("Nothing was changed")
+					return nil
+				}
+			}
+			return fn(s.BaseDir)
+		},
+	}
+}
+
 func runCli() error {
 	app := cli.App{
 		Name:    "Server Tool",
 		Version: lib.Version,
 		Action: func(ctx *cli.Context) error {
+			startMetrics()
 			return runGui()
 		},
 		Usage: "Run and manage your Minecraft servers. If no command is specified runs in GUI mode",
@@ -64,9 +167,29 @@ func runCli() error {
 							fmt.Scanln()
 						}
 					}()
+					startMetrics()
 					return runTui()
 				},
 			},
+			{
+				Name:  "web",
+				Usage: "Serve a dashboard to manage the servers from a browser",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "listen",
+						Usage: "Address the dashboard listens on",
+						Value: "127.0.0.1:8080",
+					},
+				},
+				Action: func(ctx *cli.Context) error {
+					lib.L.Info.Printf("server-tool %s\n", lib.Version)
+					lib.DetectGitAndPrint()
+					lib.RetryPendingPushes()
+					startMetrics()
+
+					return runWeb(ctx.String("listen"))
+				},
+			},
 			{
 				Name:    "list",
 				Aliases: []string{"l"},
@@ -74,6 +197,7 @@ func runCli() error {
 				Action: func(ctx *cli.Context) error {
 					lib.L.Info.Printf("server-tool %s\n", lib.Version)
 					lib.DetectGitAndPrint()
+					lib.RetryPendingPushes()
 
 					servers, err := lib.FindServers(&manifestProgressCLI{})
 					if err != nil {
@@ -95,26 +219,888 @@ func runCli() error {
 						Aliases:  []string{"n"},
 						Required: true,
 					},
+					&cli.IntFlag{
+						Name:  "java",
+						Usage: "Java version to use if the server version is unknown. It is remembered for the next runs",
+					},
+					&cli.StringFlag{
+						Name:  "on-diverge",
+						Usage: "What to do if the local and remote history have diverged: abort, remote (discard local commits) or branch (move local commits to a new branch)",
+						Value: "abort",
+					},
+					&cli.BoolFlag{
+						Name:  "accept-eula",
+						Usage: "Agree to the Minecraft EULA (" + lib.EULAURL + ")",
+					},
 				},
 				Usage: "Run a server",
 				Action: func(ctx *cli.Context) error {
 					lib.L.Info.Printf("server-tool %s\n", lib.Version)
 					lib.DetectGitAndPrint()
+					lib.RetryPendingPushes()
 
 					servers, err := lib.FindServers(&manifestProgressCLI{})
 					if err != nil {
 						return err
 					}
 
+					resolver, err := divergenceResolverCLI(ctx.String("on-diverge"))
+					if err != nil {
+						return err
+					}
+
 					name := ctx.String("name")
 					for _, s := range servers {
 						if s.Name == name {
-							return s.Start(false, &javaDownloadProgressCLI{}, gitProgressNil)
+							if java := ctx.Int("java"); java != 0 {
+								s.Settings.JavaVersion = java
+								if err = s.SaveSettings(); err != nil {
+									return err
+								}
+							}
+							if s.JavaVersion() == 0 {
+								return fmt.Errorf("%v: use the --java flag", lib.ErrUnknownJavaVersion)
+							}
+							if ctx.Bool("accept-eula") {
+								if err = lib.AcceptServerEULA(&s); err != nil {
+									return err
+								}
+							}
+
+							startMetrics()
+							err = s.Start(false, &javaDownloadProgressCLI{}, gitProgressNil, resolver, lib.StartOptions{})
+							if err == lib.ErrEULANotAccepted {
+								return fmt.Errorf("%v: read it and use the --accept-eula flag if you agree", err)
+							}
+							return err
 						}
 					}
 					return fmt.Errorf("Server %s not found", name)
 				},
 			},
+			{
+				Name: "sync",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    "name",
+						Usage:   "Server name, if omitted all the servers with unsynced changes are pushed",
+						Aliases: []string{"n"},
+					},
+				},
+				Usage: "Push the changes that could not be pushed when the server was closed",
+				Action: func(ctx *cli.Context) error {
+					lib.L.Info.Printf("server-tool %s\n", lib.Version)
+					lib.DetectGitAndPrint()
+
+					servers, err := lib.FindServers(&manifestProgressCLI{})
+					if err != nil {
+						return err
+					}
+
+					name := ctx.String("name")
+					for _, s := range servers {
+						if name == "" && s.Unsynced {
+							if err = lib.SyncServer(s.BaseDir); err != nil {
+								return err
+							}
+						} else if s.Name == name {
+							return lib.SyncServer(s.BaseDir)
+						}
+					}
+
+					if name != "" {
+						return fmt.Errorf("Server %s not found", name)
+					}
+					return nil
+				},
+			},
+			{
+				Name:  "upgrade",
+				Usage: "Upgrade a server to a newer Minecraft version",
+				Flags: []cli.Flag{
+					serverNameFlag,
+					&cli.StringFlag{
+						Name:     "to",
+						Usage:    "Target version, \"latest\" or \"latest-snapshot\"",
+						Required: true,
+					},
+					&cli.BoolFlag{
+						Name:  "force",
+						Usage: "Allow downgrades",
+					},
+					&cli.BoolFlag{
+						Name:  "force-upgrade",
+						Usage: "Run the server once with --forceUpgrade to upgrade all the chunks",
+					},
+					&cli.StringFlag{
+						Name:  "on-diverge",
+						Usage: "What to do if the local and remote history have diverged: abort, remote or branch",
+						Value: "abort",
+					},
+				},
+				Action: func(ctx *cli.Context) error {
+					lib.L.Info.Printf("server-tool %s\n", lib.Version)
+					lib.DetectGitAndPrint()
+
+					resolver, err := divergenceResolverCLI(ctx.String("on-diverge"))
+					if err != nil {
+						return err
+					}
+
+					s, err := findServerByName(ctx.String("name"))
+					if err != nil {
+						return err
+					}
+
+					target, err := lib.FindVersion(ctx.String("to"), &manifestProgressCLI{})
+					if err != nil {
+						return err
+					}
+
+					return lib.UpgradeServer(s, target, lib.UpgradeOptions{
+						Force:        ctx.Bool("force"),
+						ForceUpgrade: ctx.Bool("force-upgrade"),
+					}, &javaDownloadProgressCLI{}, gitProgressNil, resolver)
+				},
+			},
+			{
+				Name:  "sessions",
+				Usage: "Show the sessions recorded in the Git history of a server",
+				Flags: []cli.Flag{serverNameFlag},
+				Action: func(ctx *cli.Context) error {
+					lib.DetectGitAndPrint()
+
+					s, err := findServerByName(ctx.String("name"))
+					if err != nil {
+						return err
+					}
+
+					records, err := lib.SessionHistory(s.BaseDir)
+					if err != nil {
+						return err
+					}
+
+					for _, r := range records {
+						status := ""
+						if r.Crashed {
+							status = " (crashed)"
+						}
+						fmt.Printf("%s  %s  %-10s %s on %s, %s%s\n",
+							r.Commit[:7], r.Start.Format("2006-01-02 15:04"), r.End.Sub(r.Start).Round(time.Second),
+							r.MinecraftVersion, r.ServerType, r.Host, status)
+						if len(r.Players) > 0 {
+							fmt.Printf("         players: %s\n", strings.Join(r.Players, ", "))
+						}
+						if r.Usage != nil {
+							fmt.Printf("         usage: %s\n", r.Usage)
+						}
+					}
+					return nil
+				},
+			},
+			{
+				Name:  "unfuck",
+				Usage: "Fix a server whose Git repository is in a bad state. A snapshot is taken before every operation",
+				Subcommands: []*cli.Command{
+					unfuckCommand("commit", "Commit and push all the changes, removing the lock", lib.UnfuckKindCommit, lib.UnfuckCommit),
+					unfuckCommand("reset", "Discard all the local changes and reset to the remote version", lib.UnfuckKindReset, lib.UnfuckReset),
+					unfuckCommand("remove-lock", "Remove the lock file", lib.UnfuckKindRemoveLock, lib.UnfuckRemoveLock),
+					{
+						Name:  "restore",
+						Usage: "Restore a snapshot taken before an unfuck operation. If no snapshot is specified the available ones are listed",
+						Flags: []cli.Flag{
+							serverNameFlag,
+							&cli.StringFlag{
+								Name:  "snapshot",
+								Usage: "Name of the snapshot to restore",
+							},
+						},
+						Action: func(ctx *cli.Context) error {
+							lib.L.Info.Printf("server-tool %s\n", lib.Version)
+							lib.DetectGitAndPrint()
+
+							s, err := findServerByName(ctx.String("name"))
+							if err != nil {
+								return err
+							}
+
+							snapshots, err := lib.ListSnapshots(s.BaseDir)
+							if err != nil {
+								return err
+							}
+
+							name := ctx.String("snapshot")
+							for _, snap := range snapshots {
+								if name == "" {
+									fmt.Println(snap.Name())
+								} else if snap.Name() == name {
+									return lib.RestoreSnapshot(&snap)
+								}
+							}
+
+							if name != "" {
+								return fmt.Errorf("Snapshot %s not found", name)
+							}
+							return nil
+						},
+					},
+				},
+			},
+			{
+				Name:  "create",
+				Usage: "Create a new server without asking anything, the world options are written to server.properties",
+				Flags: []cli.Flag{
+					serverNameFlag,
+					&cli.StringFlag{
+						Name:  "version",
+						Usage: "Minecraft version, \"latest\" or \"latest-snapshot\"",
+						Value: lib.LatestRelease,
+					},
+					&cli.StringFlag{
+						Name:  "type",
+						Usage: "vanilla or fabric",
+						Value: "vanilla",
+					},
+					&cli.StringFlag{
+						Name:  "template",
+						Usage: "Name of a template in the templates folder of the config directory",
+					},
+					&cli.IntFlag{
+						Name:  "port",
+						Usage: "Server port",
+					},
+					&cli.StringFlag{
+						Name:  "seed",
+						Usage: "World seed",
+					},
+					&cli.StringFlag{
+						Name:  "gamemode",
+						Usage: strings.Join(lib.Gamemodes, ", "),
+					},
+					&cli.StringFlag{
+						Name:  "difficulty",
+						Usage: strings.Join(lib.Difficulties, ", "),
+					},
+					&cli.UintFlag{
+						Name:  "memory",
+						Usage: "Memory to give to the server in megabytes, by default the one in the config",
+					},
+					&cli.BoolFlag{
+						Name:  "accept-eula",
+						Usage: "Agree to the Minecraft EULA (" + lib.EULAURL + ")",
+					},
+				},
+				Action: func(ctx *cli.Context) error {
+					lib.L.Info.Printf("server-tool %s\n", lib.Version)
+
+					opts := lib.CreateOptions{
+						Port:       ctx.Int("port"),
+						Seed:       ctx.String("seed"),
+						Gamemode:   ctx.String("gamemode"),
+						Difficulty: ctx.String("difficulty"),
+						Memory:     ctx.Uint("memory"),
+					}
+
+					switch ctx.String("type") {
+					case "vanilla":
+						opts.Type = lib.Vanilla
+					case "fabric":
+						opts.Type = lib.Fabric
+					default:
+						return fmt.Errorf("Invalid value %s for --type", ctx.String("type"))
+					}
+
+					name := ctx.String("name")
+					baseDir := filepath.Join(lib.C.Application.WorkingDir, name)
+
+					var err error
+					if name := ctx.String("template"); name != "" {
+						if opts.Template, err = lib.FindTemplate(name); err != nil {
+							return err
+						}
+					}
+
+					if ctx.Bool("accept-eula") {
+						if err = lib.AcceptEULA(); err != nil {
+							return err
+						}
+					}
+
+					version, err := lib.FindVersion(ctx.String("version"), &manifestProgressCLI{})
+					if err != nil {
+						return err
+					}
+
+					s := &lib.Server{
+						Name:    name,
+						BaseDir: baseDir,
+						Version: version,
+						Type:    lib.Vanilla,
+					}
+					return lib.CreateServer(s, opts, &javaDownloadProgressCLI{})
+				},
+			},
+			{
+				Name:  "datapack",
+				Usage: "Manage the data packs of the world of a server",
+				Subcommands: []*cli.Command{
+					{
+						Name:      "add",
+						Usage:     "Install data packs from zip files, folders or Modrinth projects",
+						ArgsUsage: "<file, folder or Modrinth project>...",
+						Flags: []cli.Flag{
+							serverNameFlag,
+							&cli.BoolFlag{
+								Name:  "force",
+								Usage: "Install the data packs even if their format does not match the server version",
+							},
+						},
+						Action: func(ctx *cli.Context) error {
+							lib.L.Info.Printf("server-tool %s\n", lib.Version)
+
+							if ctx.NArg() == 0 {
+								cli.ShowSubcommandHelpAndExit(ctx, 1)
+							}
+
+							s, err := findServerByName(ctx.String("name"))
+							if err != nil {
+								return err
+							}
+
+							for _, source := range ctx.Args().Slice() {
+								if _, err = os.Stat(source); err == nil {
+									err = lib.AddDatapack(s, source, ctx.Bool("force"))
+								} else {
+									err = lib.AddDatapackFromModrinth(s, source, ctx.Bool("force"), &javaDownloadProgressCLI{})
+								}
+								if err != nil {
+									return err
+								}
+							}
+							return nil
+						},
+					},
+					{
+						Name:      "remove",
+						Usage:     "Remove data packs",
+						ArgsUsage: "<data pack>...",
+						Flags:     []cli.Flag{serverNameFlag},
+						Action: func(ctx *cli.Context) error {
+							lib.L.Info.Printf("server-tool %s\n", lib.Version)
+
+							if ctx.NArg() == 0 {
+								cli.ShowSubcommandHelpAndExit(ctx, 1)
+							}
+
+							s, err := findServerByName(ctx.String("name"))
+							if err != nil {
+								return err
+							}
+
+							for _, name := range ctx.Args().Slice() {
+								if err = lib.RemoveDatapack(s, name); err != nil {
+									return err
+								}
+							}
+							return nil
+						},
+					},
+					{
+						Name:  "list",
+						Usage: "List the installed data packs",
+						Flags: []cli.Flag{serverNameFlag},
+						Action: func(ctx *cli.Context) error {
+							s, err := findServerByName(ctx.String("name"))
+							if err != nil {
+								return err
+							}
+
+							packs, err := lib.ListDatapacks(s)
+							if err != nil {
+								return err
+							}
+
+							format := s.DataPackFormat()
+							for _, p := range packs {
+								status := ""
+								if format != 0 && !p.Supports(format) {
+									status = " (incompatible)"
+								}
+								fmt.Printf("%s  format %d%s  %s\n", p.Name, p.PackFormat, status, p.Description)
+							}
+							return nil
+						},
+					},
+				},
+			},
+			{
+				Name:  "mods",
+				Usage: "Manage the mods of a Fabric server. The installed versions are written to " + lib.ModsLockFileName,
+				Subcommands: []*cli.Command{
+					{
+						Name:      "add",
+						Usage:     "Install Modrinth projects and their dependencies",
+						ArgsUsage: "<project>...",
+						Flags:     []cli.Flag{serverNameFlag},
+						Action: func(ctx *cli.Context) error {
+							lib.L.Info.Printf("server-tool %s\n", lib.Version)
+
+							if ctx.NArg() == 0 {
+								cli.ShowSubcommandHelpAndExit(ctx, 1)
+							}
+
+							s, err := findServerByName(ctx.String("name"))
+							if err != nil {
+								return err
+							}
+
+							for _, project := range ctx.Args().Slice() {
+								if err = lib.AddMod(s, project, &javaDownloadProgressCLI{}); err != nil {
+									return err
+								}
+							}
+							return nil
+						},
+					},
+					{
+						Name:      "remove",
+						Usage:     "Remove mods and the dependencies that are no longer needed",
+						ArgsUsage: "<project>...",
+						Flags:     []cli.Flag{serverNameFlag},
+						Action: func(ctx *cli.Context) error {
+							lib.L.Info.Printf("server-tool %s\n", lib.Version)
+
+							if ctx.NArg() == 0 {
+								cli.ShowSubcommandHelpAndExit(ctx, 1)
+							}
+
+							s, err := findServerByName(ctx.String("name"))
+							if err != nil {
+								return err
+							}
+
+							for _, project := range ctx.Args().Slice() {
+								if err = lib.RemoveMod(s, project, &javaDownloadProgressCLI{}); err != nil {
+									return err
+								}
+							}
+							return nil
+						},
+					},
+					{
+						Name:      "update",
+						Usage:     "Update the given mods, or all of them, to the latest compatible version",
+						ArgsUsage: "[project]...",
+						Flags:     []cli.Flag{serverNameFlag},
+						Action: func(ctx *cli.Context) error {
+							lib.L.Info.Printf("server-tool %s\n", lib.Version)
+
+							s, err := findServerByName(ctx.String("name"))
+							if err != nil {
+								return err
+							}
+							return lib.UpdateMods(s, ctx.Args().Slice(), &javaDownloadProgressCLI{})
+						},
+					},
+					{
+						Name:  "list",
+						Usage: "List the mods in " + lib.ModsLockFileName,
+						Flags: []cli.Flag{serverNameFlag},
+						Action: func(ctx *cli.Context) error {
+							s, err := findServerByName(ctx.String("name"))
+							if err != nil {
+								return err
+							}
+
+							lock, err := lib.LoadModsLock(s.BaseDir)
+							if err != nil || lock == nil {
+								return err
+							}
+
+							for _, m := range lock.Mods {
+								requiredBy := ""
+								if len(m.RequiredBy) > 0 {
+									requiredBy = " (required by " + strings.Join(m.RequiredBy, ", ") + ")"
+								}
+								fmt.Printf("%s %s%s\n", m.Slug, m.VersionNumber, requiredBy)
+							}
+							return nil
+						},
+					},
+				},
+			},
+			{
+				Name:  "plugins",
+				Usage: "Manage the plugins of a Paper server",
+				Subcommands: []*cli.Command{
+					{
+						Name:      "add",
+						Usage:     "Install plugins from jar files or from Hangar or Modrinth projects",
+						ArgsUsage: "<jar or project>...",
+						Flags: []cli.Flag{
+							serverNameFlag,
+							&cli.StringFlag{
+								Name:  "source",
+								Usage: "Where projects are downloaded from, hangar or modrinth",
+								Value: lib.PluginSourceHangar,
+							},
+						},
+						Action: func(ctx *cli.Context) error {
+							lib.L.Info.Printf("server-tool %s\n", lib.Version)
+
+							if ctx.NArg() == 0 {
+								cli.ShowSubcommandHelpAndExit(ctx, 1)
+							}
+
+							s, err := findServerByName(ctx.String("name"))
+							if err != nil {
+								return err
+							}
+
+							for _, source := range ctx.Args().Slice() {
+								if _, err = os.Stat(source); err == nil {
+									err = lib.AddPlugin(s, source)
+								} else {
+									err = lib.AddPluginFromRepository(s, source, ctx.String("source"), &javaDownloadProgressCLI{})
+								}
+								if err != nil {
+									return err
+								}
+							}
+							return nil
+						},
+					},
+					{
+						Name:      "remove",
+						Usage:     "Remove plugins, their data folders are kept",
+						ArgsUsage: "<plugin>...",
+						Flags:     []cli.Flag{serverNameFlag},
+						Action: func(ctx *cli.Context) error {
+							lib.L.Info.Printf("server-tool %s\n", lib.Version)
+
+							if ctx.NArg() == 0 {
+								cli.ShowSubcommandHelpAndExit(ctx, 1)
+							}
+
+							s, err := findServerByName(ctx.String("name"))
+							if err != nil {
+								return err
+							}
+
+							for _, name := range ctx.Args().Slice() {
+								if err = lib.RemovePlugin(s, name); err != nil {
+									return err
+								}
+							}
+							return nil
+						},
+					},
+					{
+						Name:      "update",
+						Usage:     "Update the given plugins, or all the downloaded ones, to the latest compatible version",
+						ArgsUsage: "[plugin]...",
+						Flags:     []cli.Flag{serverNameFlag},
+						Action: func(ctx *cli.Context) error {
+							lib.L.Info.Printf("server-tool %s\n", lib.Version)
+
+							s, err := findServerByName(ctx.String("name"))
+							if err != nil {
+								return err
+							}
+							return lib.UpdatePlugins(s, ctx.Args().Slice(), &javaDownloadProgressCLI{})
+						},
+					},
+					{
+						Name:  "list",
+						Usage: "List the installed plugins",
+						Flags: []cli.Flag{serverNameFlag},
+						Action: func(ctx *cli.Context) error {
+							s, err := findServerByName(ctx.String("name"))
+							if err != nil {
+								return err
+							}
+
+							plugins, err := lib.ListPlugins(s)
+							if err != nil {
+								return err
+							}
+
+							for _, p := range plugins {
+								details := []string{}
+								if p.APIVersion != "" {
+									details = append(details, "API "+p.APIVersion)
+								}
+								if p.Source != "" {
+									details = append(details, "from "+p.Source)
+								}
+								if !p.Supports(s.Version.ID) {
+									details = append(details, "needs Minecraft "+p.APIVersion+" or newer")
+								}
+
+								line := fmt.Sprintf("%s %s", p.Name, p.Version)
+								if len(details) > 0 {
+									line += " (" + strings.Join(details, ", ") + ")"
+								}
+								fmt.Println(line)
+							}
+							return nil
+						},
+					},
+				},
+			},
+			{
+				Name:  "icon",
+				Usage: "Manage the icon shown in the server list",
+				Subcommands: []*cli.Command{
+					{
+						Name:      "set",
+						Usage:     "Crop and scale an image to 64x64 and use it as icon",
+						ArgsUsage: "<image>",
+						Flags:     []cli.Flag{serverNameFlag},
+						Action: func(ctx *cli.Context) error {
+							if ctx.NArg() != 1 {
+								cli.ShowSubcommandHelpAndExit(ctx, 1)
+							}
+
+							s, err := findServerByName(ctx.String("name"))
+							if err != nil {
+								return err
+							}
+							return lib.SetServerIcon(s, ctx.Args().First())
+						},
+					},
+					{
+						Name:  "remove",
+						Usage: "Remove the icon",
+						Flags: []cli.Flag{serverNameFlag},
+						Action: func(ctx *cli.Context) error {
+							s, err := findServerByName(ctx.String("name"))
+							if err != nil {
+								return err
+							}
+							return lib.RemoveServerIcon(s)
+						},
+					},
+				},
+			},
+			{
+				Name:  "motd",
+				Usage: "Show and change the message shown in the server list",
+				Subcommands: []*cli.Command{
+					{
+						Name:  "show",
+						Usage: "Preview the MOTD",
+						Flags: []cli.Flag{serverNameFlag},
+						Action: func(ctx *cli.Context) error {
+							s, err := findServerByName(ctx.String("name"))
+							if err != nil {
+								return err
+							}
+
+							motd, err := lib.GetMOTD(s)
+							if err != nil {
+								return err
+							}
+							fmt.Println(lib.FormatMOTDANSI(motd))
+							return nil
+						},
+					},
+					{
+						Name:      "set",
+						Usage:     "Change the MOTD. Use & or § followed by a formatting code for colors and styles and \\n to start the second line",
+						ArgsUsage: "<motd>",
+						Flags:     []cli.Flag{serverNameFlag},
+						Action: func(ctx *cli.Context) error {
+							if ctx.NArg() != 1 {
+								cli.ShowSubcommandHelpAndExit(ctx, 1)
+							}
+
+							s, err := findServerByName(ctx.String("name"))
+							if err != nil {
+								return err
+							}
+
+							motd := lib.ParseMOTDInput(ctx.Args().First())
+							if err = lib.SetMOTD(s, motd); err != nil {
+								return err
+							}
+							fmt.Println(lib.FormatMOTDANSI(motd))
+							return nil
+						},
+					},
+					{
+						Name:  "edit",
+						Usage: "Change the MOTD interactively with a preview",
+						Flags: []cli.Flag{serverNameFlag},
+						Action: func(ctx *cli.Context) error {
+							s, err := findServerByName(ctx.String("name"))
+							if err != nil {
+								return err
+							}
+							return motdEditorTUI(s)
+						},
+					},
+				},
+			},
+			{
+				Name:      "export",
+				Usage:     "Export a server to a .tar.zst or .zip archive",
+				ArgsUsage: "<archive>",
+				Flags:     []cli.Flag{serverNameFlag},
+				Action: func(ctx *cli.Context) error {
+					lib.L.Info.Printf("server-tool %s\n", lib.Version)
+					lib.DetectGitAndPrint()
+
+					if ctx.NArg() != 1 {
+						cli.ShowSubcommandHelpAndExit(ctx, 1)
+					}
+
+					s, err := findServerByName(ctx.String("name"))
+					if err != nil {
+						return err
+					}
+					return lib.ExportServer(s, ctx.Args().First())
+				},
+			},
+			{
+				Name:      "import",
+				Usage:     "Import a server exported with the export command or a Modrinth or CurseForge modpack",
+				ArgsUsage: "<archive>",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    "name",
+						Usage:   "Name of the imported server, by default the name of the exported one",
+						Aliases: []string{"n"},
+					},
+				},
+				Action: func(ctx *cli.Context) error {
+					lib.L.Info.Printf("server-tool %s\n", lib.Version)
+
+					if ctx.NArg() != 1 {
+						cli.ShowSubcommandHelpAndExit(ctx, 1)
+					}
+					archive := ctx.Args().First()
+					if lib.IsModpack(archive) {
+						manual, err := lib.ImportModpack(archive, ctx.String("name"), &manifestProgressCLI{}, &manifestProgressCLI{}, &javaDownloadProgressCLI{})
+						if err == nil && len(manual) != 0 {
+							fmt.Println(lib.FormatManualDownloads(manual))
+						}
+						return err
+					}
+					return lib.ImportServer(archive, ctx.String("name"), &manifestProgressCLI{}, &javaDownloadProgressCLI{})
+				},
+			},
+			{
+				Name:  "server",
+				Usage: "Delete, rename and duplicate servers",
+				Subcommands: []*cli.Command{
+					{
+						Name:  "rm",
+						Usage: "Move a server to the trash",
+						Flags: []cli.Flag{
+							serverNameFlag,
+							&cli.BoolFlag{
+								Name:  "force",
+								Usage: "Delete the server even if it has changes that were never pushed",
+							},
+						},
+						Action: func(ctx *cli.Context) error {
+							lib.L.Info.Printf("server-tool %s\n", lib.Version)
+							lib.DetectGitAndPrint()
+
+							s, err := findServerByName(ctx.String("name"))
+							if err != nil {
+								return err
+							}
+							return lib.DeleteServer(s, ctx.Bool("force"))
+						},
+					},
+					{
+						Name:  "mv",
+						Usage: "Rename a server",
+						Flags: []cli.Flag{
+							serverNameFlag,
+							&cli.StringFlag{
+								Name:     "to",
+								Usage:    "New name",
+								Required: true,
+							},
+						},
+						Action: func(ctx *cli.Context) error {
+							lib.L.Info.Printf("server-tool %s\n", lib.Version)
+							lib.DetectGitAndPrint()
+
+							s, err := findServerByName(ctx.String("name"))
+							if err != nil {
+								return err
+							}
+							return lib.RenameServer(s, ctx.String("to"))
+						},
+					},
+					{
+						Name:  "cp",
+						Usage: "Duplicate a server. The copy has no Git remotes",
+						Flags: []cli.Flag{
+							serverNameFlag,
+							&cli.StringFlag{
+								Name:     "to",
+								Usage:    "Name of the copy",
+								Required: true,
+							},
+						},
+						Action: func(ctx *cli.Context) error {
+							lib.L.Info.Printf("server-tool %s\n", lib.Version)
+							lib.DetectGitAndPrint()
+
+							s, err := findServerByName(ctx.String("name"))
+							if err != nil {
+								return err
+							}
+							return lib.DuplicateServer(s, ctx.String("to"))
+						},
+					},
+					{
+						Name:  "trash",
+						Usage: "List the deleted servers",
+						Action: func(ctx *cli.Context) error {
+							entries, err := lib.ListTrash()
+							if err != nil {
+								return err
+							}
+							for _, e := range entries {
+								fmt.Printf("%s  deleted on %s from %s\n", e.ID, e.DeletedAt.Format("2006-01-02 15:04"), e.OriginalPath)
+							}
+							return nil
+						},
+					},
+					{
+						Name:  "undo",
+						Usage: "Restore a deleted server, the most recently deleted one if no id is specified",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "id",
+								Usage: "Id of the deleted server, as shown by \"server trash\"",
+							},
+						},
+						Action: func(ctx *cli.Context) error {
+							lib.L.Info.Printf("server-tool %s\n", lib.Version)
+
+							id := ctx.String("id")
+							if id == "" {
+								entries, err := lib.ListTrash()
+								if err != nil {
+									return err
+								}
+								if len(entries) == 0 {
+									return fmt.Errorf("The trash is empty")
+								}
+								id = entries[0].ID
+							}
+							return lib.RestoreFromTrash(id)
+						},
+					},
+				},
+			},
 			{
 				Name:  "wipe-cache",
 				Usage: "Wipe program cache",
@@ -143,6 +1129,10 @@ func runCli() error {
 						if err := os.RemoveAll(lib.ManifestPath()); err != nil {
 							return err
 						}
+						// The cached jar versions come from the manifest
+						if err := os.RemoveAll(lib.JarCachePath()); err != nil {
+							return err
+						}
 					}
 
 					if !java && !manifest {
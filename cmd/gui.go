@@ -27,6 +27,8 @@ func moreOptions() error {
 		"Edit config",
 		"Wipe manifest cache",
 		"Wipe java cache",
+		"Restore deleted server",
+		"Import server",
 	}
 	res, err := zenityList("Advanced options", options, defaultZenityOptions...)
 	if err != nil || len(res) == 0 {
@@ -49,16 +51,189 @@ func moreOptions() error {
 			return open.Start(configPath)
 		}
 	case options[4]:
+		if err := os.RemoveAll(lib.JarCachePath()); err != nil {
+			return err
+		}
 		return os.RemoveAll(lib.ManifestPath())
 	case options[5]:
 		return os.RemoveAll(lib.JavaDir())
+	case options[6]:
+		return restoreFromTrash()
+	case options[7]:
+		return importServer()
+	}
+
+	return nil
+}
+
+func restoreFromTrash() error {
+	entries, err := lib.ListTrash()
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		_ = zenityInfo("The trash is empty", defaultZenityOptions...)
+		return nil
+	}
+
+	names := []string{}
+	for _, e := range entries {
+		names = append(names, fmt.Sprintf("%s (deleted on %s)", e.Name, e.DeletedAt.Format("2006-01-02 15:04")))
+	}
+
+	res, err := zenityList("Choose a server to restore", names, defaultZenityOptions...)
+	if err != nil || len(res) == 0 {
+		return nil
+	}
+
+	for i, name := range names {
+		if name == res {
+			return lib.RestoreFromTrash(entries[i].ID)
+		}
+	}
+	return nil
+}
+
+func renameServer(s *lib.Server, duplicate bool) error {
+	text := "New name"
+	if duplicate {
+		text = "Name of the copy"
+	}
+
+	name, err := zenityEntry(text, append(defaultZenityOptions, zenity.EntryText(s.Name))...)
+	if err != nil || name == "" || name == s.Name {
+		return serverOptions(s)
+	}
+
+	if duplicate {
+		return lib.DuplicateServer(s, name)
+	}
+	return lib.RenameServer(s, name)
+}
+
+func deleteServer(s *lib.Server) error {
+	text := fmt.Sprintf("\"%s\" will be moved to the trash. Continue?", s.Name)
+	if s.Unsynced {
+		text = fmt.Sprintf("\"%s\" has changes that were never pushed, they will only be kept in the trash. Continue?", s.Name)
+	}
+
+	err := zenityQuestion(text, append(defaultZenityOptions, zenity.OKLabel("Delete"), zenity.CancelLabel("Cancel"))...)
+	if err != nil {
+		return serverOptions(s)
+	}
+	return lib.DeleteServer(s, true)
+}
+
+var archiveFilters = zenity.FileFilters{
+	{Name: "Server archives", Patterns: []string{"*.tar.zst", "*.zip", "*.tar.gz"}},
+}
+
+func importServer() error {
+	archive, err := zenitySelectFile(append(archiveFilters, zenity.FileFilter{Name: "Modpacks", Patterns: []string{"*.mrpack", "*.zip"}}))
+	if err != nil || archive == "" {
+		return nil
+	}
+	if lib.IsModpack(archive) {
+		manual, err := lib.ImportModpack(archive, "", &manifestProgressGUI{}, &manifestProgressGUI{}, &javaDownloadProgressGUI{})
+		if err != nil || len(manual) == 0 {
+			return err
+		}
+		return zenityInfo(lib.FormatManualDownloads(manual), defaultZenityOptions...)
+	}
+	return lib.ImportServer(archive, "", &manifestProgressGUI{}, &javaDownloadProgressGUI{})
+}
+
+func exportServer(s *lib.Server) error {
+	output, err := zenitySelectFileSave(
+		zenity.Filename(s.Name+".tar.zst"),
+		zenity.ConfirmOverwrite(),
+		archiveFilters,
+	)
+	if err != nil || output == "" {
+		return serverOptions(s)
 	}
 
+	if err = lib.ExportServer(s, output); err != nil {
+		return err
+	}
+	return zenityInfo(fmt.Sprintf("\"%s\" was exported to %s", s.Name, output), defaultZenityOptions...)
+}
+
+func changeIcon(s *lib.Server) error {
+	image, err := zenitySelectFile(zenity.FileFilters{
+		{Name: "Images", Patterns: []string{"*.png", "*.jpg", "*.jpeg", "*.gif"}},
+	})
+	if err != nil || image == "" {
+		return serverOptions(s)
+	}
+	return lib.SetServerIcon(s, image)
+}
+
+func editMOTD(s *lib.Server) error {
+	motd, err := lib.GetMOTD(s)
+	if err != nil {
+		return err
+	}
+
+	input, err := zenityEntry(
+		"Enter the MOTD, use & followed by a formatting code to change colors and styles and \\n to start the second line",
+		append(defaultZenityOptions, zenity.EntryText(lib.MOTDToInput(motd)))...,
+	)
+	if err != nil {
+		return serverOptions(s)
+	}
+	return lib.SetMOTD(s, lib.ParseMOTDInput(input))
+}
+
+func confirmUnfuck(s *lib.Server, kind lib.UnfuckKind) bool {
+	preview, err := lib.PreviewUnfuck(s.BaseDir, kind)
+	if err != nil {
+		_ = zenityError(fmt.Sprintf("Unable to compute what will change: %v", err), defaultZenityOptions...)
+		return false
+	}
+
+	err = zenityQuestion(
+		preview.String()+"\nA snapshot will be taken before continuing.",
+		append(defaultZenityOptions, zenity.OKLabel("Continue"), zenity.CancelLabel("Cancel"))...)
+	return err == nil
+}
+
+func restoreSnapshot(s *lib.Server) error {
+	snapshots, err := lib.ListSnapshots(s.BaseDir)
+	if err != nil {
+		return err
+	}
+	if len(snapshots) == 0 {
+		_ = zenityInfo("There are no snapshots for this server", defaultZenityOptions...)
+		return nil
+	}
+
+	names := []string{}
+	for _, snap := range snapshots {
+		names = append(names, snap.Name())
+	}
+
+	res, err := zenityList("Choose a snapshot to restore", names, defaultZenityOptions...)
+	if err != nil || len(res) == 0 {
+		return nil
+	}
+
+	for _, snap := range snapshots {
+		if snap.Name() == res {
+			err = zenityQuestion(
+				fmt.Sprintf("Everything that changed after %s will be lost. Continue?", snap.Name()),
+				append(defaultZenityOptions, zenity.OKLabel("Restore"), zenity.CancelLabel("Cancel"))...)
+			if err != nil {
+				return nil
+			}
+			return lib.RestoreSnapshot(&snap)
+		}
+	}
 	return nil
 }
 
 func unfuck(s *lib.Server) error {
-	options := []string{"HELP! - Open documentation", "Manual save", "Reset from origin", "Remove lock"}
+	options := []string{"HELP! - Open documentation", "Manual save", "Reset from origin", "Remove lock", "Restore snapshot"}
 
 	res, err := zenityList("Unfuck menu: BE CAREFUL!", options, defaultZenityOptions...)
 
@@ -70,11 +245,19 @@ func unfuck(s *lib.Server) error {
 	case options[0]:
 		err = open.Start("https://github.com/billy4479/server-tool/blob/master/Unfuck.md")
 	case options[1]:
-		err = lib.UnfuckCommit(s.BaseDir)
+		if confirmUnfuck(s, lib.UnfuckKindCommit) {
+			err = lib.UnfuckCommit(s.BaseDir)
+		}
 	case options[2]:
-		err = lib.UnfuckReset(s.BaseDir)
+		if confirmUnfuck(s, lib.UnfuckKindReset) {
+			err = lib.UnfuckReset(s.BaseDir)
+		}
 	case options[3]:
-		err = lib.UnfuckRemoveLock(s.BaseDir)
+		if confirmUnfuck(s, lib.UnfuckKindRemoveLock) {
+			err = lib.UnfuckRemoveLock(s.BaseDir)
+		}
+	case options[4]:
+		err = restoreSnapshot(s)
 	}
 
 	if err != nil {
@@ -191,6 +374,17 @@ func createNew() (*lib.Server, error) {
 		return chooseServer()
 	}
 
+	template, err := chooseTemplate()
+	if err != nil {
+		return nil, err
+	}
+
+	if !lib.HasAcceptedEULA() && !lib.C.Minecraft.NoEULA && confirmEULA() {
+		if err = lib.AcceptEULA(); err != nil {
+			return nil, err
+		}
+	}
+
 	server := &lib.Server{
 		Name:    name,
 		BaseDir: path.Join(lib.C.Application.WorkingDir, name),
@@ -199,7 +393,31 @@ func createNew() (*lib.Server, error) {
 		HasGit:  false,
 	}
 
-	return server, lib.CreateServer(server)
+	return server, lib.CreateServer(server, lib.CreateOptions{Template: template}, &javaDownloadProgressGUI{})
+}
+
+func chooseTemplate() (*lib.Template, error) {
+	templates, err := lib.ListTemplates()
+	if err != nil || len(templates) == 0 {
+		return nil, err
+	}
+
+	names := []string{"No template"}
+	for _, t := range templates {
+		names = append(names, t.Name)
+	}
+
+	res, err := zenityList("Choose a template for the server", names, defaultZenityOptions...)
+	if err != nil {
+		return nil, nil
+	}
+
+	for _, t := range templates {
+		if t.Name == res {
+			return &t, nil
+		}
+	}
+	return nil, nil
 }
 
 func chooseName() string {
@@ -333,6 +551,130 @@ func gitProgressGUI() func(string) {
 	}
 }
 
+func divergenceResolverGUI(ahead, behind int) (lib.DivergenceChoice, error) {
+	options := []string{
+		"Abort",
+		"Keep remote (discard local commits)",
+		"Keep remote (save local commits to a new branch)",
+	}
+
+	res, err := zenityList(
+		fmt.Sprintf("The local history has diverged from the remote one: %d local commits, %d remote commits", ahead, behind),
+		options, defaultZenityOptions...)
+	if err != nil {
+		return lib.DivergenceAbort, nil
+	}
+
+	switch res {
+	case options[1]:
+		return lib.DivergenceKeepRemote, nil
+	case options[2]:
+		return lib.DivergenceKeepLocalAsBranch, nil
+	}
+	return lib.DivergenceAbort, nil
+}
+
+func chooseJavaVersion(s *lib.Server) error {
+	if s.JavaVersion() != 0 {
+		return nil
+	}
+
+	versions := []string{}
+	for _, v := range lib.KnownJavaVersions {
+		versions = append(versions, fmt.Sprintf("Java %d", v))
+	}
+
+	res, err := zenityList(
+		fmt.Sprintf("The version of \"%s\" is unknown. Which Java version should be used to run it?", s.Name),
+		versions, defaultZenityOptions...)
+	if err != nil {
+		return err
+	}
+
+	for i, v := range versions {
+		if v == res {
+			s.Settings.JavaVersion = lib.KnownJavaVersions[i]
+			return s.SaveSettings()
+		}
+	}
+	return lib.ErrUnknownJavaVersion
+}
+
+// confirmEULA asks the user to agree to the Minecraft EULA
+func confirmEULA() bool {
+	for {
+		err := zenityQuestion(
+			fmt.Sprintf("To run a Minecraft server you must agree to the Minecraft EULA (%s).\nDo you agree to it?", lib.EULAURL),
+			append(defaultZenityOptions,
+				zenity.OKLabel("I agree"),
+				zenity.CancelLabel("Cancel"),
+				zenity.ExtraButton("Read the EULA"),
+			)...)
+
+		switch err {
+		case nil:
+			return true
+		case zenity.ErrExtraButton:
+			if err = open.Start(lib.EULAURL); err != nil {
+				lib.L.Warn.Printf("Unable to open the EULA: %v\n", err)
+			}
+		default:
+			return false
+		}
+	}
+}
+
+func startServer(s *lib.Server) error {
+	if err := chooseJavaVersion(s); err != nil {
+		return err
+	}
+
+	if lib.NeedsEULA(s) {
+		if !confirmEULA() {
+			return nil
+		}
+		if err := lib.AcceptServerEULA(s); err != nil {
+			return err
+		}
+	}
+	return s.Start(true, &javaDownloadProgressGUI{}, gitProgressGUI, divergenceResolverGUI, lib.StartOptions{})
+}
+
+func upgradeServer(s *lib.Server) error {
+	target, err := chooseVersion()
+	if err != nil || target == nil {
+		return err
+	}
+
+	opts := lib.UpgradeOptions{}
+	err = zenityQuestion(
+		fmt.Sprintf("Upgrade \"%s\" from %s to %s?\nA snapshot of the server will be taken first.", s.Name, s.Version.ID, target.ID),
+		append(defaultZenityOptions,
+			zenity.OKLabel("Upgrade"),
+			zenity.CancelLabel("Cancel"),
+			zenity.ExtraButton("Upgrade and optimize world"),
+		)...)
+	switch err {
+	case nil:
+	case zenity.ErrExtraButton:
+		opts.ForceUpgrade = true
+	default:
+		return nil
+	}
+
+	err = lib.UpgradeServer(s, target, opts, &javaDownloadProgressGUI{}, gitProgressGUI, divergenceResolverGUI)
+	if err == lib.ErrDowngrade {
+		if zenityQuestion(
+			fmt.Sprintf("%s is older than %s. Downgrading can corrupt the world, continue anyway?", target.ID, s.Version.ID),
+			append(defaultZenityOptions, zenity.OKLabel("Downgrade"), zenity.CancelLabel("Cancel"))...) != nil {
+			return nil
+		}
+		opts.Force = true
+		err = lib.UpgradeServer(s, target, opts, &javaDownloadProgressGUI{}, gitProgressGUI, divergenceResolverGUI)
+	}
+	return err
+}
+
 func serverOptions(s *lib.Server) error {
 	res := zenityQuestion(fmt.Sprintf("Server \"%s\" was selected", s.PrettyName()),
 		append(defaultZenityOptions,
@@ -343,19 +685,19 @@ func serverOptions(s *lib.Server) error {
 
 	switch res {
 	case nil:
-		return s.Start(true, &javaDownloadProgressGUI{}, gitProgressGUI)
+		return startServer(s)
 	case zenity.ErrCanceled:
 		return res
 	case zenity.ErrExtraButton:
 		{
-			options := []string{"Run", "Open folder", "Unfuck", "Install Fabric"}
+			options := []string{"Run", "Open folder", "Unfuck", "Install Fabric", "Upgrade", "Rename", "Duplicate", "Delete", "Export", "Change icon", "Edit MOTD"}
 			res, err := zenityList("More options", options, defaultZenityOptions...)
 			if err != nil || len(res) == 0 {
 				return serverOptions(s)
 			}
 			switch res {
 			case options[0]:
-				return s.Start(true, &javaDownloadProgressGUI{}, gitProgressGUI)
+				return startServer(s)
 			case options[1]:
 				return open.Start(s.BaseDir)
 			case options[2]:
@@ -363,6 +705,20 @@ func serverOptions(s *lib.Server) error {
 			case options[3]:
 				_ = zenityInfo("Not yet implemented", defaultZenityOptions...)
 				return nil
+			case options[4]:
+				return upgradeServer(s)
+			case options[5]:
+				return renameServer(s, false)
+			case options[6]:
+				return renameServer(s, true)
+			case options[7]:
+				return deleteServer(s)
+			case options[8]:
+				return exportServer(s)
+			case options[9]:
+				return changeIcon(s)
+			case options[10]:
+				return editMOTD(s)
 			}
 		}
 	}
@@ -399,6 +755,7 @@ func checkUpdates() error {
 func runGui() (err error) {
 	lib.L.Info.Printf("server-tool %s\n", lib.Version)
 	lib.DetectGitAndPrint()
+	lib.RetryPendingPushes()
 
 	defer func() {
 		if err != nil {
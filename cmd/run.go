@@ -40,3 +40,14 @@ func Run() error {
 	}
 	return err
 }
+
+// startMetrics serves the metrics for the commands that keep running, the
+// short ones would only make the port flap
+func startMetrics() {
+	if !lib.C.Metrics.Enable {
+		return
+	}
+	if err := lib.StartMetricsServer(); err != nil {
+		lib.L.Warn.Println(err)
+	}
+}
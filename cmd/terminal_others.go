@@ -0,0 +1,8 @@
+//go:build !linux
+
+package cmd
+
+// terminalRows returns 0 since the resource usage is only shown on Linux
+func terminalRows() int {
+	return 0
+}
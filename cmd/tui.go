@@ -112,34 +112,400 @@ func makeServersMenuItem(servers []lib.Server) []Option {
 	result := []Option{}
 
 	for _, s := range servers {
+		s := s
 		desc := fmt.Sprintf("\"%s\" (", s.Name)
-		if s.Version == nil {
-			desc += "?? on ??"
+		if s.Version == nil || s.VersionStatus == lib.VersionUnknown {
+			desc += "??"
 		} else {
-			desc += fmt.Sprintf("%s on ", s.Version.ID)
-			switch s.Type {
-			case lib.Vanilla:
-				desc += "Vanilla"
-			case lib.Fabric:
-				desc += "Fabric"
+			desc += s.Version.ID
+			if s.VersionStatus == lib.VersionFromMetadata && s.Type != lib.Paper {
+				desc += "?"
 			}
 		}
 
+		desc += " on "
+		switch s.Type {
+		case lib.Vanilla:
+			desc += "Vanilla"
+		case lib.Fabric:
+			desc += "Fabric"
+		case lib.Paper:
+			desc += "Paper"
+		}
+
 		if s.HasGit {
 			desc += " - Git"
 		}
 
+		for _, status := range s.SyncStatus() {
+			desc += ", " + status
+		}
+
 		desc += ")"
 
 		result = append(result, Option{
 			Description: desc,
-			Action:      func() error { return s.Start(lib.C.Minecraft.GUI, &javaDownloadProgressTUI{}, gitProgressNil) },
+			Action: func() error {
+				return startServerTUI(&s)
+			},
 		})
 	}
 
 	return result
 }
 
+func divergenceResolverTUI(ahead, behind int) (lib.DivergenceChoice, error) {
+	color.Yellow("[!] The local history has diverged from the remote one: %d local commits, %d remote commits", ahead, behind)
+	color.Blue("[?] What do we do?")
+
+	choice := lib.DivergenceAbort
+	opt, err := makeMenu(false,
+		Option{
+			Description: "Abort",
+			Action:      func() error { choice = lib.DivergenceAbort; return nil },
+		},
+		Option{
+			Description: "Keep the remote version and discard the local commits",
+			Action:      func() error { choice = lib.DivergenceKeepRemote; return nil },
+		},
+		Option{
+			Description: "Keep the remote version and save the local commits to a new branch",
+			Action:      func() error { choice = lib.DivergenceKeepLocalAsBranch; return nil },
+		},
+	)
+	if err != nil {
+		return lib.DivergenceAbort, err
+	}
+
+	return choice, opt.Action()
+}
+
+func chooseJavaVersionTUI(s *lib.Server) error {
+	if s.JavaVersion() != 0 {
+		return nil
+	}
+
+	color.Yellow("[!] The version of \"%s\" is unknown. Which Java version should be used to run it?", s.Name)
+	options := []Option{}
+	for _, v := range lib.KnownJavaVersions {
+		v := v
+		options = append(options, Option{
+			Description: fmt.Sprintf("Java %d", v),
+			Action: func() error {
+				s.Settings.JavaVersion = v
+				return s.SaveSettings()
+			},
+		})
+	}
+
+	opt, err := makeMenu(true, options...)
+	if err != nil {
+		return err
+	}
+	return opt.Action()
+}
+
+// confirmEULATUI asks the user to agree to the Minecraft EULA
+func confirmEULATUI() (bool, error) {
+	agreed := false
+	color.Blue("[?] To run a Minecraft server you must agree to the Minecraft EULA (%s). Do you agree to it?", lib.EULAURL)
+	opt, err := makeMenu(false,
+		Option{Description: "No", Action: func() error { return nil }},
+		Option{Description: "Yes, I agree", Action: func() error { agreed = true; return nil }},
+	)
+	if err != nil {
+		return false, err
+	}
+	_ = opt.Action()
+	return agreed, nil
+}
+
+func startServerTUI(s *lib.Server) error {
+	if err := chooseJavaVersionTUI(s); err != nil {
+		return err
+	}
+
+	if lib.NeedsEULA(s) {
+		agreed, err := confirmEULATUI()
+		if err != nil || !agreed {
+			return err
+		}
+		if err = lib.AcceptServerEULA(s); err != nil {
+			return err
+		}
+	}
+	return s.Start(lib.C.Minecraft.GUI, &javaDownloadProgressTUI{}, gitProgressNil, divergenceResolverTUI, lib.StartOptions{Monitor: &processMonitorTUI{}})
+}
+
+func chooseVersionTUI(versions []lib.VersionInfo, desc string) (*lib.VersionInfo, error) {
+	versionStr, err := StringOption(
+		desc,
+		func(s string) bool {
+			if s == "" {
+				return false
+			}
+
+			if s == "?" {
+				for _, v := range versions {
+					fmt.Printf("[+] %s\n", v.ID)
+				}
+				return false
+			}
+
+			for _, v := range versions {
+				if v.ID == s {
+					return true
+				}
+			}
+
+			color.Yellow("[?] Version %s was not found. Type ? for a list of the available versions", s)
+			return false
+		},
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, v := range versions {
+		if v.ID == versionStr {
+			return &v, nil
+		}
+	}
+
+	panic("NOT REACHED")
+}
+
+func upgradeServerTUI(s *lib.Server) error {
+	versions, err := lib.GetVersionInfos(newManifestProgressTUI())
+	if err != nil {
+		return err
+	}
+
+	target, err := chooseVersionTUI(versions, fmt.Sprintf("Enter the version to upgrade \"%s\" to (? to list all versions)", s.Name))
+	if err != nil {
+		return err
+	}
+
+	opts := lib.UpgradeOptions{}
+	color.Blue("[?] Run the server once to upgrade all the chunks of the world?")
+	opt, err := makeMenu(false,
+		Option{Description: "No", Action: func() error { return nil }},
+		Option{Description: "Yes", Action: func() error { opts.ForceUpgrade = true; return nil }},
+	)
+	if err != nil {
+		return err
+	}
+	_ = opt.Action()
+
+	err = lib.UpgradeServer(s, target, opts, &javaDownloadProgressTUI{}, gitProgressNil, divergenceResolverTUI)
+	if err != lib.ErrDowngrade {
+		return err
+	}
+
+	color.Yellow("[!] %s is older than %s. Downgrading can corrupt the world, continue anyway?", target.ID, s.Version.ID)
+	opt, err = makeMenu(false,
+		Option{Description: "No", Action: func() error { return nil }},
+		Option{Description: "Yes", Action: func() error {
+			opts.Force = true
+			return lib.UpgradeServer(s, target, opts, &javaDownloadProgressTUI{}, gitProgressNil, divergenceResolverTUI)
+		}},
+	)
+	if err != nil {
+		return err
+	}
+	return opt.Action()
+}
+
+func manageServerTUI(s *lib.Server) error {
+	color.Blue("[?] What do we do with \"%s\"?", s.Name)
+	opt, err := makeMenu(false,
+		Option{
+			Description: "Start",
+			Action:      func() error { return startServerTUI(s) },
+		},
+		Option{
+			Description: "Upgrade to a new Minecraft version",
+			Action:      func() error { return upgradeServerTUI(s) },
+		},
+		Option{
+			Description: "Open folder",
+			Action:      func() error { return open.Start(s.BaseDir) },
+		},
+		Option{
+			Description: "Rename",
+			Action: func() error {
+				name, err := StringOption("Enter the new name", nil)
+				if err != nil {
+					return err
+				}
+				return lib.RenameServer(s, name)
+			},
+		},
+		Option{
+			Description: "Duplicate",
+			Action: func() error {
+				name, err := StringOption("Enter the name of the copy", nil)
+				if err != nil {
+					return err
+				}
+				return lib.DuplicateServer(s, name)
+			},
+		},
+		Option{
+			Description: "Delete",
+			Action:      func() error { return deleteServerTUI(s) },
+		},
+		Option{
+			Description: "Export to an archive",
+			Action: func() error {
+				output, err := StringOption("Enter the path of the archive (.tar.zst or .zip)", nil)
+				if err != nil {
+					return err
+				}
+				return lib.ExportServer(s, output)
+			},
+		},
+		Option{
+			Description: "Change icon",
+			Action: func() error {
+				image, err := StringOption("Enter the path of the image (.png, .jpg or .gif)", nil)
+				if err != nil {
+					return err
+				}
+				return lib.SetServerIcon(s, image)
+			},
+		},
+		Option{
+			Description: "Edit MOTD",
+			Action:      func() error { return motdEditorTUI(s) },
+		},
+	)
+	if err != nil {
+		return err
+	}
+	return opt.Action()
+}
+
+func printMOTDPreview(motd string) {
+	fmt.Println()
+	fmt.Println(lib.FormatMOTDANSI(motd))
+	fmt.Println()
+}
+
+// motdEditorTUI asks the lines of the MOTD until the user is happy with the
+// preview
+func motdEditorTUI(s *lib.Server) error {
+	motd, err := lib.GetMOTD(s)
+	if err != nil {
+		return err
+	}
+
+	color.Blue("[*] The current MOTD is:")
+	printMOTDPreview(motd)
+	color.Blue("[*] Use & followed by a formatting code to change colors and styles, for example &6&lGold bold&r")
+
+	for {
+		first, err := StringOption("Enter the first line", nil)
+		if err != nil {
+			return err
+		}
+		second, err := StringOption("Enter the second line (leave empty for none)", func(string) bool { return true })
+		if err != nil {
+			return err
+		}
+
+		motd = lib.ParseMOTDInput(first)
+		if second != "" {
+			motd += "\n" + lib.ParseMOTDInput(second)
+		}
+
+		color.Blue("[*] Players will see:")
+		printMOTDPreview(motd)
+
+		edit := false
+		color.Blue("[?] Save the MOTD?")
+		opt, err := makeMenu(false,
+			Option{Description: "Yes", Action: func() error { return lib.SetMOTD(s, motd) }},
+			Option{Description: "Edit again", Action: func() error { edit = true; return nil }},
+			Option{Description: "Cancel", Action: func() error { return nil }},
+		)
+		if err != nil {
+			return err
+		}
+		if err = opt.Action(); err != nil || !edit {
+			return err
+		}
+	}
+}
+
+func chooseTemplateTUI() (*lib.Template, error) {
+	templates, err := lib.ListTemplates()
+	if err != nil || len(templates) == 0 {
+		return nil, err
+	}
+
+	var result *lib.Template
+	options := []Option{{Description: "No template", Action: func() error { return nil }}}
+	for _, t := range templates {
+		t := t
+		options = append(options, Option{
+			Description: t.Name,
+			Action:      func() error { result = &t; return nil },
+		})
+	}
+
+	color.Blue("[?] Which template do we use?")
+	opt, err := makeMenu(false, options...)
+	if err != nil {
+		return nil, err
+	}
+	_ = opt.Action()
+	return result, nil
+}
+
+func deleteServerTUI(s *lib.Server) error {
+	if s.Unsynced {
+		color.Yellow("[!] \"%s\" has changes that were never pushed, they will only be kept in the trash.", s.Name)
+	}
+	color.Blue("[?] Move \"%s\" to the trash?", s.Name)
+	opt, err := makeMenu(false,
+		Option{Description: "No", Action: func() error { return nil }},
+		Option{Description: "Yes", Action: func() error { return lib.DeleteServer(s, true) }},
+	)
+	if err != nil {
+		return err
+	}
+	return opt.Action()
+}
+
+func restoreFromTrashTUI() error {
+	entries, err := lib.ListTrash()
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		color.Yellow("[!] The trash is empty")
+		return nil
+	}
+
+	color.Blue("[?] Which server do we restore?")
+	options := []Option{}
+	for _, e := range entries {
+		e := e
+		options = append(options, Option{
+			Description: fmt.Sprintf("%s (deleted on %s)", e.Name, e.DeletedAt.Format("2006-01-02 15:04")),
+			Action:      func() error { return lib.RestoreFromTrash(e.ID) },
+		})
+	}
+
+	opt, err := makeMenu(true, options...)
+	if err != nil {
+		return err
+	}
+	return opt.Action()
+}
+
 type manifestProgressTUI struct {
 	total   int
 	current int
@@ -174,6 +540,36 @@ func (p *manifestProgressTUI) Done() {
 	p.Unlock()
 }
 
+// processMonitorTUI keeps the resource usage of the server on the last line
+// of the terminal, the output of the server scrolls above it
+type processMonitorTUI struct {
+	rows int
+}
+
+func (m *processMonitorTUI) Update(stats lib.ProcessStats) {
+	if m.rows == 0 {
+		m.rows = terminalRows()
+		if m.rows < 3 {
+			m.rows = -1
+		}
+		if m.rows > 0 {
+			// Restrict scrolling to the other lines, this moves the cursor
+			fmt.Printf("\0337\033[1;%dr\0338", m.rows-1)
+		}
+	}
+	if m.rows < 0 {
+		return
+	}
+	fmt.Printf("\0337\033[%d;1H\033[2K%s\0338", m.rows, color.CyanString("[*] %s", stats))
+}
+
+func (m *processMonitorTUI) Done() {
+	if m.rows > 0 {
+		fmt.Printf("\0337\033[r\033[%d;1H\033[2K\0338", m.rows)
+	}
+	m.rows = 0
+}
+
 type javaDownloadProgressTUI struct {
 	total   string
 	current uint64
@@ -209,6 +605,7 @@ func (p *javaDownloadProgressTUI) OnExtractionDone() {
 func runTui() error {
 	lib.L.Info.Printf("server-tool %s\n", lib.Version)
 	lib.DetectGitAndPrint()
+	lib.RetryPendingPushes()
 
 	needUpdate, newVersionURL, err := lib.CheckUpdates()
 	if err != nil {
@@ -259,6 +656,31 @@ func runTui() error {
 				return c.Action()
 			},
 		},
+		Option{
+			Description: "Manage a server",
+			Action: func() error {
+				servers, err := lib.FindServers(newManifestProgressTUI())
+				if err != nil {
+					return err
+				}
+
+				color.Blue("[?] Which server?")
+				options := []Option{}
+				for _, s := range servers {
+					s := s
+					options = append(options, Option{
+						Description: s.PrettyName(),
+						Action:      func() error { return manageServerTUI(&s) },
+					})
+				}
+
+				c, err := makeMenu(true, options...)
+				if err != nil {
+					return err
+				}
+				return c.Action()
+			},
+		},
 		Option{
 			Description: "Create new a server",
 			Action: func() error {
@@ -275,53 +697,56 @@ func runTui() error {
 
 				s.BaseDir = path.Join(lib.C.Application.WorkingDir, s.Name)
 
-				versionStr, err := StringOption(
-					"Enter a version for the new server (? to list all versions)",
-					func(s string) bool {
-						if s == "" {
-							return false
-						}
-
-						if s == "?" {
-							for _, v := range versions {
-								fmt.Printf("[+] %s\n", v.ID)
-							}
-							return false
-						}
-
-						for _, v := range versions {
-							if v.ID == s {
-								return true
-							}
-						}
-
-						color.Yellow("[?] Version %s was not found. Type ? for a list of the available versions", s)
-						return false
-					},
-				)
-
+				s.Version, err = chooseVersionTUI(versions, "Enter a version for the new server (? to list all versions)")
 				if err != nil {
 					return err
 				}
 
-				for _, v := range versions {
-					if v.ID == versionStr {
-						s.Version = &v
-						break
-					}
+				template, err := chooseTemplateTUI()
+				if err != nil {
+					return err
 				}
 
-				if s.Version == nil {
-					panic("NOT REACHED")
+				if !lib.HasAcceptedEULA() && !lib.C.Minecraft.NoEULA {
+					agreed, err := confirmEULATUI()
+					if err != nil {
+						return err
+					}
+					if agreed {
+						if err = lib.AcceptEULA(); err != nil {
+							return err
+						}
+					}
 				}
 
-				err = lib.CreateServer(&s)
+				err = lib.CreateServer(&s, lib.CreateOptions{Template: template}, &javaDownloadProgressTUI{})
 				if err != nil {
 					return err
 				}
 				return nil
 			},
 		},
+		Option{
+			Description: "Import a server from an archive or a modpack",
+			Action: func() error {
+				archive, err := StringOption("Enter the path of the archive or of the modpack", nil)
+				if err != nil {
+					return err
+				}
+				if lib.IsModpack(archive) {
+					manual, err := lib.ImportModpack(archive, "", newManifestProgressTUI(), newManifestProgressTUI(), &javaDownloadProgressTUI{})
+					if err == nil && len(manual) != 0 {
+						fmt.Println(lib.FormatManualDownloads(manual))
+					}
+					return err
+				}
+				return lib.ImportServer(archive, "", newManifestProgressTUI(), &javaDownloadProgressTUI{})
+			},
+		},
+		Option{
+			Description: "Restore a deleted server",
+			Action:      restoreFromTrashTUI,
+		},
 		Option{
 			Description: "Open server folder",
 			Action: func() error {
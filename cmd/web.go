@@ -0,0 +1,618 @@
+package cmd
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/billy4479/server-tool/lib"
+)
+
+//go:embed web/index.html
+var webIndex []byte
+
+const (
+	webTokenCookie = "server-tool-token"
+	// Output kept for the browsers that connect after the server started
+	consoleBacklogSize = 256 * 1024
+	// Messages queued for a browser before it is disconnected
+	consoleClientQueue = 256
+)
+
+// consoleHub keeps the recent output of the servers and sends it to the
+// connected browsers
+type consoleHub struct {
+	mutex   sync.Mutex
+	backlog []byte
+	clients map[chan []byte]struct{}
+}
+
+func newConsoleHub() *consoleHub {
+	return &consoleHub{clients: map[chan []byte]struct{}{}}
+}
+
+func (h *consoleHub) Write(p []byte) (int, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.backlog = append(h.backlog, p...)
+	if len(h.backlog) > consoleBacklogSize {
+		h.backlog = h.backlog[len(h.backlog)-consoleBacklogSize:]
+	}
+
+	for c := range h.clients {
+		select {
+		case c <- append([]byte{}, p...):
+		default:
+			// The browser is not keeping up, it can reconnect to get the
+			// backlog
+			delete(h.clients, c)
+			close(c)
+		}
+	}
+	return len(p), nil
+}
+
+// Printf writes a message of server-tool to the console
+func (h *consoleHub) Printf(format string, a ...interface{}) {
+	fmt.Fprintf(h, "[server-tool] "+format, a...)
+}
+
+func (h *consoleHub) subscribe() ([]byte, chan []byte) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	c := make(chan []byte, consoleClientQueue)
+	h.clients[c] = struct{}{}
+	return append([]byte{}, h.backlog...), c
+}
+
+func (h *consoleHub) unsubscribe(c chan []byte) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if _, ok := h.clients[c]; ok {
+		delete(h.clients, c)
+		close(c)
+	}
+}
+
+// webRun is a server started from the dashboard
+type webRun struct {
+	name string
+	// Standard input of the server, nil until it is started
+	stdin *os.File
+}
+
+type webDashboard struct {
+	token   string
+	console *consoleHub
+
+	mutex sync.Mutex
+	// Only one server runs at a time, like in the other modes. Its
+	// repository is in use until Start returns, Git synchronizations included.
+	run *webRun
+	// Servers an unfuck action is running on
+	busy map[string]bool
+}
+
+type webServer struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Version     string   `json:"version"`
+	Type        string   `json:"type"`
+	HasGit      bool     `json:"hasGit"`
+	Running     bool     `json:"running"`
+	Dashboard   bool     `json:"dashboard"`
+	LockedBy    string   `json:"lockedBy"`
+	Ahead       int      `json:"ahead"`
+	Behind      int      `json:"behind"`
+	Dirty       bool     `json:"dirty"`
+	Unsynced    bool     `json:"unsynced"`
+	Status      []string `json:"status"`
+	JavaVersion int      `json:"javaVersion"`
+}
+
+type webError struct {
+	Error string `json:"error"`
+	// Set when the user has to agree to the EULA or choose a Java version
+	EULA        bool  `json:"eula,omitempty"`
+	JavaChoices []int `json:"javaChoices,omitempty"`
+}
+
+var webUnfuckActions = map[string]struct {
+	kind lib.UnfuckKind
+	fn   func(string) error
+}{
+	"commit":      {lib.UnfuckKindCommit, lib.UnfuckCommit},
+	"reset":       {lib.UnfuckKindReset, lib.UnfuckReset},
+	"remove-lock": {lib.UnfuckKindRemoveLock, lib.UnfuckRemoveLock},
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		lib.L.Debug.Printf("Unable to send the response: %v\n", err)
+	}
+}
+
+func writeJSONError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, &webError{Error: err.Error()})
+}
+
+// readJSON decodes the body of a POST request. Requiring JSON also keeps
+// other websites from sending requests with plain forms.
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if r.Method != http.MethodPost || mediaType != "application/json" {
+		writeJSONError(w, http.StatusBadRequest, errors.New("Expected a POST request with a JSON body"))
+		return false
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, 64*1024)).Decode(v); err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Errorf("Invalid request: %v", err))
+		return false
+	}
+	return true
+}
+
+func newWebToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func (d *webDashboard) validToken(token string) bool {
+	return subtle.ConstantTimeCompare([]byte(token), []byte(d.token)) == 1
+}
+
+func (d *webDashboard) authorized(r *http.Request) bool {
+	if c, err := r.Cookie(webTokenCookie); err == nil && d.validToken(c.Value) {
+		return true
+	}
+	bearer := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return bearer != "" && d.validToken(bearer)
+}
+
+func (d *webDashboard) requireToken(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !d.authorized(r) {
+			writeJSONError(w, http.StatusUnauthorized, errors.New("Missing or invalid token"))
+			return
+		}
+		next(w, r)
+	}
+}
+
+// handleIndex exchanges the token in the link for a cookie, so that it does
+// not stay in the address bar, and serves the dashboard
+func (d *webDashboard) handleIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	if token := r.URL.Query().Get("token"); token != "" && d.validToken(token) {
+		http.SetCookie(w, &http.Cookie{
+			Name:     webTokenCookie,
+			Value:    token,
+			Path:     "/",
+			HttpOnly: true,
+			SameSite: http.SameSiteStrictMode,
+		})
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	if !d.authorized(r) {
+		http.Error(w, "Open the link printed by server-tool to use the dashboard", http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	_, _ = w.Write(webIndex)
+}
+
+// handleServers only fetches the remotes when asked, and never while a server
+// runs: the fetch would race with the pull and push done by Start
+func (d *webDashboard) handleServers(w http.ResponseWriter, r *http.Request) {
+	d.mutex.Lock()
+	running := ""
+	if d.run != nil {
+		running = d.run.name
+	}
+	d.mutex.Unlock()
+
+	find := lib.FindServersWithoutFetch
+	if r.URL.Query().Get("fetch") == "1" && running == "" && lib.C.Git.FetchOnList {
+		find = lib.FindServers
+	}
+	servers, err := find(&manifestProgressCLI{})
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	result := []webServer{}
+	for _, s := range servers {
+		result = append(result, webServer{
+			Name:        s.Name,
+			Description: s.PrettyName(),
+			Version:     s.Version.ID,
+			Type:        s.Type.String(),
+			HasGit:      s.HasGit,
+			Running:     s.IsRunning() || s.Name == running,
+			Dashboard:   s.Name == running,
+			LockedBy:    s.GitStatus.LockedBy,
+			Ahead:       s.GitStatus.Ahead,
+			Behind:      s.GitStatus.Behind,
+			Dirty:       s.GitStatus.Dirty,
+			Unsynced:    s.Unsynced,
+			Status:      s.SyncStatus(),
+			JavaVersion: s.JavaVersion(),
+		})
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// findServerWithoutFetch does not fetch the other repositories, an action
+// could be using them. Start and the unfuck actions fetch by themselves.
+func findServerWithoutFetch(name string) (*lib.Server, error) {
+	servers, err := lib.FindServersWithoutFetch(&manifestProgressCLI{})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, s := range servers {
+		if s.Name == name {
+			return &s, nil
+		}
+	}
+	return nil, fmt.Errorf("Server %s not found", name)
+}
+
+type webStartRequest struct {
+	Name       string `json:"name"`
+	AcceptEULA bool   `json:"acceptEula"`
+	Java       int    `json:"java"`
+	OnDiverge  string `json:"onDiverge"`
+}
+
+func (d *webDashboard) handleStart(w http.ResponseWriter, r *http.Request) {
+	req := webStartRequest{}
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	d.mutex.Lock()
+	if d.run != nil {
+		name := d.run.name
+		d.mutex.Unlock()
+		writeJSONError(w, http.StatusConflict, fmt.Errorf("\"%s\" is already running, stop it first", name))
+		return
+	}
+	if d.busy[req.Name] {
+		d.mutex.Unlock()
+		writeJSONError(w, http.StatusConflict, fmt.Errorf("An unfuck action is running on \"%s\"", req.Name))
+		return
+	}
+	run := &webRun{name: req.Name}
+	d.run = run
+	d.mutex.Unlock()
+
+	status, err := d.start(run, &req)
+	if err != nil {
+		d.mutex.Lock()
+		d.run = nil
+		d.mutex.Unlock()
+
+		e := &webError{Error: err.Error()}
+		if err == lib.ErrEULANotAccepted {
+			e.EULA = true
+		} else if err == lib.ErrUnknownJavaVersion {
+			e.JavaChoices = lib.KnownJavaVersions
+		}
+		writeJSON(w, status, e)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, struct{}{})
+}
+
+// start checks that the server can be started and runs it in the background,
+// it returns the HTTP status of the error
+func (d *webDashboard) start(run *webRun, req *webStartRequest) (int, error) {
+	s, err := findServerWithoutFetch(req.Name)
+	if err != nil {
+		return http.StatusNotFound, err
+	}
+	if s.IsRunning() {
+		return http.StatusConflict, lib.ErrServerRunning
+	}
+
+	resolver, err := divergenceResolverCLI(req.OnDiverge)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	if req.Java != 0 {
+		s.Settings.JavaVersion = req.Java
+		if err = s.SaveSettings(); err != nil {
+			return http.StatusInternalServerError, err
+		}
+	}
+	if s.JavaVersion() == 0 {
+		return http.StatusConflict, lib.ErrUnknownJavaVersion
+	}
+
+	if lib.NeedsEULA(s) {
+		if !req.AcceptEULA {
+			return http.StatusConflict, lib.ErrEULANotAccepted
+		}
+		if err = lib.AcceptServerEULA(s); err != nil {
+			return http.StatusInternalServerError, err
+		}
+	}
+
+	// A real file is handed to the JVM as is, with any other reader the
+	// process would not be waited until the reader is closed
+	stdinR, stdinW, err := os.Pipe()
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	d.mutex.Lock()
+	run.stdin = stdinW
+	d.mutex.Unlock()
+
+	d.console.Printf("Starting \"%s\"\n", s.Name)
+	go func() {
+		err := s.Start(false, &javaDownloadProgressCLI{}, gitProgressNil, resolver, lib.StartOptions{
+			Console: &lib.Console{
+				Input:  stdinR,
+				Output: io.MultiWriter(lib.L.Writer, d.console),
+			},
+		})
+
+		d.mutex.Lock()
+		d.run = nil
+		d.mutex.Unlock()
+		stdinR.Close()
+		stdinW.Close()
+
+		if err != nil {
+			lib.L.Error.Println(err)
+			d.console.Printf("\"%s\" stopped with an error: %v\n", s.Name, err)
+		} else {
+			d.console.Printf("\"%s\" stopped\n", s.Name)
+		}
+	}()
+	return 0, nil
+}
+
+// sendCommand writes a line to the standard input of the running server
+func (d *webDashboard) sendCommand(name string, command string) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.run == nil || d.run.stdin == nil || (name != "" && d.run.name != name) {
+		return errors.New("The server is not running from the dashboard")
+	}
+	_, err := io.WriteString(d.run.stdin, command+"\n")
+	return err
+}
+
+type webNameRequest struct {
+	Name string `json:"name"`
+}
+
+func (d *webDashboard) handleStop(w http.ResponseWriter, r *http.Request) {
+	req := webNameRequest{}
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	if err := d.sendCommand(req.Name, "stop"); err != nil {
+		writeJSONError(w, http.StatusConflict, err)
+		return
+	}
+	d.console.Printf("Stopping \"%s\"\n", req.Name)
+	writeJSON(w, http.StatusAccepted, struct{}{})
+}
+
+type webUnfuckRequest struct {
+	Name string `json:"name"`
+	Kind string `json:"kind"`
+}
+
+// handleUnfuck returns the preview of the action on GET and runs it on POST
+func (d *webDashboard) handleUnfuck(w http.ResponseWriter, r *http.Request) {
+	req := webUnfuckRequest{
+		Name: r.URL.Query().Get("name"),
+		Kind: r.URL.Query().Get("kind"),
+	}
+	if r.Method != http.MethodGet && !readJSON(w, r, &req) {
+		return
+	}
+
+	action, ok := webUnfuckActions[req.Kind]
+	if !ok {
+		writeJSONError(w, http.StatusBadRequest, fmt.Errorf("Unknown unfuck action %s", req.Kind))
+		return
+	}
+
+	// The repository must not be used by a start or another action at the
+	// same time
+	d.mutex.Lock()
+	if d.run != nil && d.run.name == req.Name {
+		d.mutex.Unlock()
+		writeJSONError(w, http.StatusConflict, lib.ErrServerRunning)
+		return
+	}
+	if d.busy[req.Name] {
+		d.mutex.Unlock()
+		writeJSONError(w, http.StatusConflict, fmt.Errorf("An unfuck action is already running on \"%s\"", req.Name))
+		return
+	}
+	d.busy[req.Name] = true
+	d.mutex.Unlock()
+	defer func() {
+		d.mutex.Lock()
+		delete(d.busy, req.Name)
+		d.mutex.Unlock()
+	}()
+
+	s, err := findServerWithoutFetch(req.Name)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, err)
+		return
+	}
+	if !s.HasGit {
+		writeJSONError(w, http.StatusBadRequest, fmt.Errorf("\"%s\" does not use Git", s.Name))
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		preview, err := lib.PreviewUnfuck(s.BaseDir, action.kind)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, struct {
+			Preview string `json:"preview"`
+		}{preview.String()})
+		return
+	}
+
+	if s.IsRunning() {
+		writeJSONError(w, http.StatusConflict, lib.ErrServerRunning)
+		return
+	}
+	if err = action.fn(s.BaseDir); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	d.console.Printf("Unfuck %s done on \"%s\"\n", req.Kind, s.Name)
+	writeJSON(w, http.StatusOK, struct{}{})
+}
+
+// sameOrigin rejects WebSocket connections opened by other websites, which
+// would be sent the cookie
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	host := strings.TrimPrefix(strings.TrimPrefix(origin, "http://"), "https://")
+	return host == r.Host
+}
+
+// handleConsole streams the output of the servers, the messages sent by the
+// browser are commands for the running server
+func (d *webDashboard) handleConsole(w http.ResponseWriter, r *http.Request) {
+	if !sameOrigin(r) {
+		http.Error(w, "Cross-origin WebSocket connections are not allowed", http.StatusForbidden)
+		return
+	}
+
+	conn, err := wsUpgrade(w, r)
+	if err != nil {
+		lib.L.Debug.Printf("Unable to open the console: %v\n", err)
+		return
+	}
+	defer conn.Close()
+
+	backlog, output := d.console.subscribe()
+	defer d.console.unsubscribe(output)
+
+	go func() {
+		for {
+			msg, err := conn.ReadMessage()
+			if err != nil {
+				if err != io.EOF {
+					lib.L.Debug.Printf("Console connection closed: %v\n", err)
+				}
+				// Makes the writing loop exit
+				d.console.unsubscribe(output)
+				return
+			}
+
+			command := strings.TrimSpace(string(msg))
+			if command == "" {
+				continue
+			}
+			if err = d.sendCommand("", command); err != nil {
+				d.console.Printf("%v\n", err)
+				continue
+			}
+			fmt.Fprintf(d.console, "> %s\n", command)
+		}
+	}()
+
+	if len(backlog) > 0 {
+		if err = conn.WriteText(backlog); err != nil {
+			return
+		}
+	}
+	for p := range output {
+		if err = conn.WriteText(p); err != nil {
+			return
+		}
+	}
+}
+
+func runWeb(listen string) error {
+	token, err := newWebToken()
+	if err != nil {
+		return err
+	}
+
+	d := &webDashboard{
+		token:   token,
+		console: newConsoleHub(),
+		busy:    map[string]bool{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", d.handleIndex)
+	mux.HandleFunc("/api/servers", d.requireToken(d.handleServers))
+	mux.HandleFunc("/api/start", d.requireToken(d.handleStart))
+	mux.HandleFunc("/api/stop", d.requireToken(d.handleStop))
+	mux.HandleFunc("/api/unfuck", d.requireToken(d.handleUnfuck))
+	mux.HandleFunc("/api/console", d.requireToken(d.handleConsole))
+
+	listener, err := net.Listen("tcp", listen)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+
+	host, port, err := net.SplitHostPort(listener.Addr().String())
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		lib.L.Warn.Println("The dashboard can be reached from other machines, the token is the only protection and it is not encrypted")
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsUnspecified() {
+		host = "localhost"
+	}
+
+	url := fmt.Sprintf("http://%s/?token=%s", net.JoinHostPort(host, port), token)
+	lib.L.Ok.Println("Dashboard started, open this link to use it:")
+	fmt.Println(url)
+
+	return http.Serve(listener, mux)
+}
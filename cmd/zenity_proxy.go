@@ -124,3 +124,25 @@ func zenityError(text string, options ...zenity.Option) error {
 
 	return err
 }
+
+func zenitySelectFile(options ...zenity.Option) (string, error) {
+	res, err := zenity.SelectFile(append(defaultZenityOptions, options...)...)
+
+	lib.L.Debug.Printf(
+		`zenity (select file): result:"%s" error:"%s"`+"\n",
+		res, err,
+	)
+
+	return res, err
+}
+
+func zenitySelectFileSave(options ...zenity.Option) (string, error) {
+	res, err := zenity.SelectFileSave(append(defaultZenityOptions, options...)...)
+
+	lib.L.Debug.Printf(
+		`zenity (select file save): result:"%s" error:"%s"`+"\n",
+		res, err,
+	)
+
+	return res, err
+}
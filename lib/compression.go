@@ -10,6 +10,8 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+
+	"github.com/klauspost/compress/zstd"
 )
 
 // https://snyk.io/research/zip-slip-vulnerability#go
@@ -31,8 +33,19 @@ func Untargz(input io.Reader, dest string, skipName string, onExtractionProgress
 	if err != nil {
 		return err
 	}
-	// Create a tar Reader
-	tr := tar.NewReader(r)
+	return untar(tar.NewReader(r), dest, skipName, onExtractionProgress)
+}
+
+func Untarzst(input io.Reader, dest string, skipName string, onExtractionProgress func(string)) error {
+	r, err := zstd.NewReader(input)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return untar(tar.NewReader(r), dest, skipName, onExtractionProgress)
+}
+
+func untar(tr *tar.Reader, dest string, skipName string, onExtractionProgress func(string)) error {
 	basename := ""
 	// Iterate through the files in the archive.
 	for {
@@ -64,13 +77,16 @@ func Untargz(input io.Reader, dest string, skipName string, onExtractionProgress
 			}
 		case tar.TypeReg:
 			// write a file
+			if err = os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
+				return err
+			}
 			file, err := os.OpenFile(destPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, fs.FileMode(header.Mode))
 			if err != nil {
 				return err
 			}
-			defer file.Close()
 
 			_, err = io.Copy(file, tr)
+			file.Close()
 			if err != nil {
 				return err
 			}
@@ -116,25 +132,170 @@ func Unzip(input io.ReaderAt, size int64, dest string, skipName string, onExtrac
 			return err
 		}
 
-		outFile, err := os.OpenFile(destPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, f.Mode())
+		if err = unzipFile(f, destPath); err != nil {
+			return err
+		}
+
+		onExtractionProgress(f.Name)
+	}
+
+	return nil
+}
+
+// unzipFile closes the files before returning, archives can have thousands
+// of entries
+func unzipFile(f *zip.File, destPath string) error {
+	zipFileReader, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer zipFileReader.Close()
+
+	outFile, err := os.OpenFile(destPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, f.Mode())
+	if err != nil {
+		return err
+	}
+
+	if _, err = io.Copy(outFile, zipFileReader); err != nil {
+		outFile.Close()
+		return err
+	}
+	return outFile.Close()
+}
+
+// archiveWriter is implemented by the archive formats that servers can be
+// exported to
+type archiveWriter interface {
+	writeDir(name string, info fs.FileInfo) error
+	writeFile(name string, info fs.FileInfo, r io.Reader) error
+	Close() error
+}
+
+type tarArchive struct {
+	tw         *tar.Writer
+	compressor io.WriteCloser
+}
+
+func newTarArchive(compressor io.WriteCloser) *tarArchive {
+	return &tarArchive{tar.NewWriter(compressor), compressor}
+}
+
+func (a *tarArchive) writeDir(name string, info fs.FileInfo) error {
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	header.Name = name + "/"
+	return a.tw.WriteHeader(header)
+}
+
+func (a *tarArchive) writeFile(name string, info fs.FileInfo, r io.Reader) error {
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	if err = a.tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err = io.Copy(a.tw, r)
+	return err
+}
+
+func (a *tarArchive) Close() error {
+	if err := a.tw.Close(); err != nil {
+		return err
+	}
+	return a.compressor.Close()
+}
+
+type zipArchive struct {
+	zw *zip.Writer
+}
+
+func (a *zipArchive) writeDir(name string, info fs.FileInfo) error {
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name = name + "/"
+	_, err = a.zw.CreateHeader(header)
+	return err
+}
+
+func (a *zipArchive) writeFile(name string, info fs.FileInfo, r io.Reader) error {
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	header.Method = zip.Deflate
+	w, err := a.zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+	return err
+}
+
+func (a *zipArchive) Close() error { return a.zw.Close() }
+
+// addTree adds the content of src to the archive.
+// Paths for which skip returns true are not included, if a directory is
+// skipped its content is skipped too.
+func addTree(a archiveWriter, src string, skip func(relPath string) bool) error {
+	return filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
-		defer outFile.Close()
 
-		zipFileReader, err := f.Open()
+		rel, err := filepath.Rel(src, p)
 		if err != nil {
 			return err
 		}
-		defer zipFileReader.Close()
+		if rel == "." {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
 
-		_, err = io.Copy(outFile, zipFileReader)
+		if skip != nil && skip(rel) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		info, err := d.Info()
 		if err != nil {
 			return err
 		}
 
-		onExtractionProgress(f.Name)
-	}
+		if info.IsDir() {
+			return a.writeDir(rel, info)
+		}
 
-	return nil
+		// Symlinks and other special files are not needed for Minecraft servers
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		return a.writeFile(rel, info, f)
+	})
+}
+
+// Targz writes the content of src to output as a .tar.gz archive.
+// Paths for which skip returns true are not included, if a directory is
+// skipped its content is skipped too.
+func Targz(output io.Writer, src string, skip func(relPath string) bool) error {
+	a := newTarArchive(gzip.NewWriter(output))
+	if err := addTree(a, src, skip); err != nil {
+		return err
+	}
+	return a.Close()
 }
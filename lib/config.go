@@ -3,6 +3,7 @@ package lib
 import (
 	"os"
 	"path/filepath"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -18,10 +19,54 @@ type Config struct {
 		GUI    bool
 		NoEULA bool
 		Memory uint
+		// When the user agreed to the Minecraft EULA, zero if they never did
+		EULAAcceptedAt time.Time `yaml:",omitempty"`
 	}
 	Git struct {
-		Enable      bool
-		UseLockFile bool
+		Enable         bool
+		UseLockFile    bool
+		FetchOnList    bool
+		CommitTemplate string
+	}
+	Export struct {
+		Exclude []string
+	}
+	Modrinth struct {
+		URL string
+	}
+	CurseForge struct {
+		URL    string
+		APIKey string
+	}
+	Hangar struct {
+		URL string
+	}
+	ResourcePack struct {
+		// Address the players use to download the resource packs served by
+		// this host, the local address is used if empty
+		Host string
+	}
+	Watchdog struct {
+		Enable bool
+		// Time between two pings of the server
+		Interval time.Duration
+		// Number of pings in a row the server has to miss to be stopped
+		Failures uint
+		// Time the server has to answer the first ping, the world could be
+		// generated in the meantime
+		StartupGrace time.Duration
+	}
+	Monitor struct {
+		Enable bool
+		// Time between two samples of the resource usage of the server
+		Interval time.Duration
+		// Time between two summaries in the log, 0 to disable them
+		SummaryInterval time.Duration
+	}
+	Metrics struct {
+		Enable bool
+		// Address of the HTTP server that serves /metrics
+		Listen string
 	}
 	UseSystemJava bool
 }
@@ -73,6 +118,39 @@ func NewConfig() *Config {
 	{
 		c.Git.Enable = true
 		c.Git.UseLockFile = true
+		c.Git.FetchOnList = true
+		c.Git.CommitTemplate = DefaultCommitTemplate
+	}
+	{
+		c.Export.Exclude = []string{"libraries", "versions", "logs", "crash-reports", "cache", ".git", "*.part"}
+	}
+	{
+		c.Modrinth.URL = "https://api.modrinth.com/v2"
+	}
+	{
+		c.CurseForge.URL = "https://api.curseforge.com/v1"
+		c.CurseForge.APIKey = ""
+	}
+	{
+		c.Hangar.URL = "https://hangar.papermc.io/api/v1"
+	}
+	{
+		c.ResourcePack.Host = ""
+	}
+	{
+		c.Watchdog.Enable = false
+		c.Watchdog.Interval = 30 * time.Second
+		c.Watchdog.Failures = 4
+		c.Watchdog.StartupGrace = 10 * time.Minute
+	}
+	{
+		c.Monitor.Enable = true
+		c.Monitor.Interval = 5 * time.Second
+		c.Monitor.SummaryInterval = 15 * time.Minute
+	}
+	{
+		c.Metrics.Enable = false
+		c.Metrics.Listen = "localhost:9225"
 	}
 	c.UseSystemJava = false
 	return c
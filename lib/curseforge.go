@@ -0,0 +1,316 @@
+package lib
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	curseforgeManifestName = "manifest.json"
+	curseforgeManifestType = "minecraftModpack"
+	curseforgeSHA1         = 1
+	// Class ids of the projects that are only useful to the client
+	curseforgeResourcePacks = 12
+	curseforgeShaders       = 6552
+)
+
+// ManualDownload is a file that could not be downloaded automatically and
+// has to be placed in the server folder by the user
+type ManualDownload struct {
+	Name string
+	// Page where the file can be downloaded
+	URL string
+	// Path relative to the server folder
+	Path string
+}
+
+type curseforgeManifest struct {
+	Minecraft struct {
+		Version    string `json:"version"`
+		ModLoaders []struct {
+			ID      string `json:"id"`
+			Primary bool   `json:"primary"`
+		} `json:"modLoaders"`
+	} `json:"minecraft"`
+	ManifestType string `json:"manifestType"`
+	Name         string `json:"name"`
+	Version      string `json:"version"`
+	Files        []struct {
+		ProjectID int  `json:"projectID"`
+		FileID    int  `json:"fileID"`
+		Required  bool `json:"required"`
+	} `json:"files"`
+	Overrides string `json:"overrides"`
+}
+
+type curseforgeFile struct {
+	ID          int    `json:"id"`
+	ModID       int    `json:"modId"`
+	FileName    string `json:"fileName"`
+	DownloadURL string `json:"downloadUrl"`
+	Hashes      []struct {
+		Value string `json:"value"`
+		Algo  int    `json:"algo"`
+	} `json:"hashes"`
+}
+
+type curseforgeMod struct {
+	ID      int    `json:"id"`
+	Name    string `json:"name"`
+	ClassID int    `json:"classId"`
+	Links   struct {
+		WebsiteURL string `json:"websiteUrl"`
+	} `json:"links"`
+}
+
+// curseforgePost sends body as JSON and decodes the data field of the response
+func curseforgePost(path string, body any, out any) error {
+	if C.CurseForge.APIKey == "" {
+		return errors.New("The CurseForge API requires a key, set curseforge.apikey in the config")
+	}
+
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	u := strings.TrimRight(C.CurseForge.URL, "/") + path
+	L.Debug.Printf("POST %s\n", u)
+	req, err := http.NewRequest(http.MethodPost, u, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("x-api-key", C.CurseForge.APIKey)
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("CurseForge request %s failed: %s", path, res.Status)
+	}
+
+	data := struct {
+		Data any `json:"data"`
+	}{Data: out}
+	return json.NewDecoder(res.Body).Decode(&data)
+}
+
+func (f *curseforgeFile) checksum() checksum {
+	for _, h := range f.Hashes {
+		if h.Algo == curseforgeSHA1 {
+			return sha1Checksum(h.Value)
+		}
+	}
+	return noChecksum
+}
+
+func readCurseforgeManifest(r *zip.Reader) (*curseforgeManifest, error) {
+	for _, f := range r.File {
+		if f.Name != curseforgeManifestName {
+			continue
+		}
+
+		b, err := readZipFile(f)
+		if err != nil {
+			return nil, err
+		}
+
+		manifest := &curseforgeManifest{}
+		if err = json.Unmarshal(b, manifest); err != nil {
+			return nil, fmt.Errorf("Invalid %s: %v", curseforgeManifestName, err)
+		}
+		if manifest.ManifestType != curseforgeManifestType {
+			return nil, fmt.Errorf("%s is not a Minecraft modpack", curseforgeManifestName)
+		}
+		return manifest, nil
+	}
+	return nil, fmt.Errorf("%s is missing", curseforgeManifestName)
+}
+
+// isCurseforgeModpack reports whether the zip contains a CurseForge manifest
+func isCurseforgeModpack(path string) bool {
+	if !strings.EqualFold(filepath.Ext(path), ".zip") {
+		return false
+	}
+
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return false
+	}
+	defer r.Close()
+
+	_, err = readCurseforgeManifest(&r.Reader)
+	return err == nil
+}
+
+// loader returns the name and the version of the primary mod loader,
+// the ids look like fabric-0.15.0
+func (m *curseforgeManifest) loader() (string, string) {
+	loaders := m.Minecraft.ModLoaders
+	if len(loaders) == 0 {
+		return "", ""
+	}
+
+	id := loaders[0].ID
+	for _, l := range loaders {
+		if l.Primary {
+			id = l.ID
+			break
+		}
+	}
+
+	name, version, _ := strings.Cut(id, "-")
+	return name, version
+}
+
+// resolveCurseforgeFiles returns the files and the projects they belong to
+func resolveCurseforgeFiles(manifest *curseforgeManifest) ([]curseforgeFile, map[int]curseforgeMod, error) {
+	fileIDs := []int{}
+	modIDs := []int{}
+	for _, f := range manifest.Files {
+		if f.Required {
+			fileIDs = append(fileIDs, f.FileID)
+			modIDs = append(modIDs, f.ProjectID)
+		}
+	}
+	if len(fileIDs) == 0 {
+		return []curseforgeFile{}, map[int]curseforgeMod{}, nil
+	}
+
+	files := []curseforgeFile{}
+	if err := curseforgePost("/mods/files", map[string][]int{"fileIds": fileIDs}, &files); err != nil {
+		return nil, nil, err
+	}
+	if len(files) != len(fileIDs) {
+		return nil, nil, fmt.Errorf("CurseForge returned %d of the %d files of the modpack", len(files), len(fileIDs))
+	}
+
+	mods := []curseforgeMod{}
+	if err := curseforgePost("/mods", map[string][]int{"modIds": modIDs}, &mods); err != nil {
+		return nil, nil, err
+	}
+	byID := map[int]curseforgeMod{}
+	for _, m := range mods {
+		byID[m.ID] = m
+	}
+	return files, byID, nil
+}
+
+// downloadCurseforgeFiles downloads the mods to the mods folder and returns
+// the ones whose authors do not allow third party downloads
+func downloadCurseforgeFiles(files []curseforgeFile, mods map[int]curseforgeMod, dest string, progress ModpackProgress) ([]ManualDownload, error) {
+	progress.SetTotal(len(files))
+	defer progress.Done()
+
+	manual := []ManualDownload{}
+	for _, f := range files {
+		mod, ok := mods[f.ModID]
+		if !ok {
+			mod = curseforgeMod{ID: f.ModID, Name: f.FileName}
+		}
+		if mod.ClassID == curseforgeResourcePacks || mod.ClassID == curseforgeShaders {
+			L.Debug.Printf("Skipping %s since it is only used by the client\n", f.FileName)
+			progress.Add(f.FileName)
+			continue
+		}
+
+		rel := filepath.Join(modsDirName, f.FileName)
+		if err := checkIllegalPath(dest, rel); err != nil {
+			return nil, err
+		}
+
+		if f.DownloadURL == "" {
+			page := fmt.Sprintf("https://www.curseforge.com/projects/%d", mod.ID)
+			if mod.Links.WebsiteURL != "" {
+				page = fmt.Sprintf("%s/files/%d", mod.Links.WebsiteURL, f.ID)
+			}
+			manual = append(manual, ManualDownload{Name: mod.Name, URL: page, Path: rel})
+			progress.Add(f.FileName)
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Join(dest, modsDirName), 0755); err != nil {
+			return nil, err
+		}
+		if err := downloadFile(f.DownloadURL, filepath.Join(dest, rel), f.checksum(), silentDownload{}); err != nil {
+			return nil, err
+		}
+		progress.Add(f.FileName)
+	}
+	return manual, nil
+}
+
+func importCurseforge(path string, name string, progress ModpackProgress, manifestProgress ManifestDownloadProgress, download DownloadProgress) (manual []ManualDownload, err error) {
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	manifest, err := readCurseforgeManifest(&r.Reader)
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		name = manifest.Name
+	}
+
+	// Resolve the files first, there is no point in creating the server
+	// if the API cannot be used
+	files, mods, err := resolveCurseforgeFiles(manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	L.Info.Printf("Importing %s %s\n", manifest.Name, manifest.Version)
+	loader, loaderVersion := manifest.loader()
+	s, err := modpackServer(name, manifest.Minecraft.Version, loader, loaderVersion, manifestProgress, download)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			os.RemoveAll(s.BaseDir)
+		}
+	}()
+
+	if manual, err = downloadCurseforgeFiles(files, mods, s.BaseDir, progress); err != nil {
+		return nil, err
+	}
+
+	overrides := manifest.Overrides
+	if overrides == "" {
+		overrides = "overrides"
+	}
+	if err = extractZipPrefix(&r.Reader, strings.TrimSuffix(overrides, "/")+"/", s.BaseDir); err != nil {
+		return nil, err
+	}
+
+	for _, m := range manual {
+		L.Warn.Printf("%s must be downloaded manually from %s and placed in %s\n", m.Name, m.URL, m.Path)
+	}
+	L.Ok.Printf("%s imported as \"%s\"\n", manifest.Name, s.Name)
+	return manual, nil
+}
+
+// FormatManualDownloads describes the files the user has to download
+func FormatManualDownloads(manual []ManualDownload) string {
+	var b strings.Builder
+	b.WriteString("The authors of these mods do not allow them to be downloaded automatically, download them and place them in the server folder:\n")
+	for _, m := range manual {
+		fmt.Fprintf(&b, "\n%s (%s)\n  %s\n", m.Name, m.Path, m.URL)
+	}
+	return b.String()
+}
@@ -0,0 +1,357 @@
+package lib
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	packMetaFileName = "pack.mcmeta"
+	datapacksDirName = "datapacks"
+	defaultLevelName = "world"
+	modrinthDatapack = "datapack"
+)
+
+// A Datapack is a zip file or a folder in the datapacks folder of the world
+type Datapack struct {
+	Name        string
+	Path        string
+	Description string
+	PackFormat  int
+	// Range of supported formats, equal to PackFormat if not specified
+	MinFormat int
+	MaxFormat int
+}
+
+// DatapacksDir returns the datapacks folder of the world set in
+// server.properties
+func (s *Server) DatapacksDir() (string, error) {
+	props, err := LoadProperties(filepath.Join(s.BaseDir, PropertiesFileName))
+	if err != nil {
+		return "", err
+	}
+
+	level := props.GetOr("level-name", defaultLevelName)
+	if level == "" {
+		level = defaultLevelName
+	}
+	if err = checkIllegalPath(s.BaseDir, level); err != nil {
+		return "", err
+	}
+	return filepath.Join(s.BaseDir, level, datapacksDirName), nil
+}
+
+// DataPackFormat returns the data pack format supported by the server jar,
+// or 0 if it is unknown
+func (s *Server) DataPackFormat() int {
+	jar := s.JarName
+	if s.Type == Fabric {
+		jar = VanillaJarName
+	}
+
+	meta, err := readJarMetadata(filepath.Join(s.BaseDir, jar))
+	if err != nil || meta == nil {
+		return 0
+	}
+	return meta.DataPackFormat
+}
+
+// parseSupportedFormats reads supported_formats, which can be a number,
+// a [min, max] list or an object with min_inclusive and max_inclusive
+func parseSupportedFormats(raw json.RawMessage) (int, int, bool) {
+	if len(raw) == 0 {
+		return 0, 0, false
+	}
+
+	var n int
+	if err := json.Unmarshal(raw, &n); err == nil {
+		return n, n, true
+	}
+
+	var list []int
+	if err := json.Unmarshal(raw, &list); err == nil && len(list) == 2 {
+		return list[0], list[1], true
+	}
+
+	var obj struct {
+		Min int `json:"min_inclusive"`
+		Max int `json:"max_inclusive"`
+	}
+	if err := json.Unmarshal(raw, &obj); err == nil {
+		return obj.Min, obj.Max, true
+	}
+	return 0, 0, false
+}
+
+// parseFormatVersion reads a format that is either a number or a
+// [major, minor] list, only the major version is considered
+func parseFormatVersion(raw json.RawMessage) (int, bool) {
+	if len(raw) == 0 {
+		return 0, false
+	}
+
+	var n int
+	if err := json.Unmarshal(raw, &n); err == nil {
+		return n, true
+	}
+
+	var list []int
+	if err := json.Unmarshal(raw, &list); err == nil && len(list) > 0 {
+		return list[0], true
+	}
+	return 0, false
+}
+
+func parsePackMeta(b []byte, pack *Datapack) error {
+	var meta struct {
+		Pack struct {
+			PackFormat       int             `json:"pack_format"`
+			Description      json.RawMessage `json:"description"`
+			SupportedFormats json.RawMessage `json:"supported_formats"`
+			MinFormat        json.RawMessage `json:"min_format"`
+			MaxFormat        json.RawMessage `json:"max_format"`
+		} `json:"pack"`
+	}
+	if err := json.Unmarshal(b, &meta); err != nil {
+		return fmt.Errorf("Invalid %s: %v", packMetaFileName, err)
+	}
+
+	pack.PackFormat = meta.Pack.PackFormat
+	pack.MinFormat, pack.MaxFormat = pack.PackFormat, pack.PackFormat
+	if min, max, ok := parseSupportedFormats(meta.Pack.SupportedFormats); ok {
+		pack.MinFormat, pack.MaxFormat = min, max
+	}
+	// Since 1.21.9 the range is given by min_format and max_format
+	if min, ok := parseFormatVersion(meta.Pack.MinFormat); ok {
+		pack.MinFormat = min
+	}
+	if max, ok := parseFormatVersion(meta.Pack.MaxFormat); ok {
+		pack.MaxFormat = max
+	}
+	if pack.PackFormat == 0 {
+		pack.PackFormat = pack.MaxFormat
+	}
+
+	// The description is either a string or a text component
+	if err := json.Unmarshal(meta.Pack.Description, &pack.Description); err != nil {
+		pack.Description = string(meta.Pack.Description)
+	}
+
+	if pack.PackFormat == 0 {
+		return fmt.Errorf("%s does not contain a pack format", packMetaFileName)
+	}
+	return nil
+}
+
+// readDatapack reads the pack.mcmeta of a data pack zip or folder
+func readDatapack(path string) (*Datapack, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	pack := &Datapack{
+		Name: filepath.Base(path),
+		Path: path,
+	}
+
+	var b []byte
+	if info.IsDir() {
+		b, err = os.ReadFile(filepath.Join(path, packMetaFileName))
+	} else {
+		var r *zip.ReadCloser
+		if r, err = zip.OpenReader(path); err != nil {
+			return nil, fmt.Errorf("%s is not a data pack: %v", pack.Name, err)
+		}
+		defer r.Close()
+
+		var f *zip.File
+		for _, zf := range r.File {
+			if zf.Name == packMetaFileName {
+				f = zf
+				break
+			}
+		}
+		if f == nil {
+			return nil, fmt.Errorf("%s is not a data pack: %s is missing", pack.Name, packMetaFileName)
+		}
+		b, err = readZipFile(f)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return pack, parsePackMeta(b, pack)
+}
+
+// Supports reports whether the data pack works with the given format
+func (p *Datapack) Supports(format int) bool {
+	return format >= p.MinFormat && format <= p.MaxFormat
+}
+
+// ListDatapacks returns the data packs installed in the world of the server
+func ListDatapacks(s *Server) ([]Datapack, error) {
+	dir, err := s.DatapacksDir()
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return []Datapack{}, nil
+		}
+		return nil, err
+	}
+
+	packs := []Datapack{}
+	for _, e := range entries {
+		if !e.IsDir() && filepath.Ext(e.Name()) != ".zip" {
+			continue
+		}
+
+		pack, err := readDatapack(filepath.Join(dir, e.Name()))
+		if err != nil {
+			L.Warn.Println(err)
+			continue
+		}
+		packs = append(packs, *pack)
+	}
+	return packs, nil
+}
+
+// checkDatapack fails if the data pack does not support the format of the
+// server, unless force is true
+func checkDatapack(s *Server, pack *Datapack, force bool) error {
+	format := s.DataPackFormat()
+	if format == 0 {
+		L.Warn.Printf("Unable to tell which data pack format \"%s\" supports, %s may not work\n", s.Name, pack.Name)
+		return nil
+	}
+
+	if pack.Supports(format) {
+		return nil
+	}
+
+	msg := fmt.Sprintf("%s uses format %d but Minecraft %s uses format %d", pack.Name, pack.PackFormat, s.Version.ID, format)
+	if force {
+		L.Warn.Println(msg)
+		return nil
+	}
+	return errors.New(msg + ", force the installation to install it anyway")
+}
+
+// AddDatapack installs a data pack from a local zip or folder
+func AddDatapack(s *Server, source string, force bool) error {
+	if s.IsRunning() {
+		return ErrServerRunning
+	}
+
+	pack, err := readDatapack(source)
+	if err != nil {
+		return err
+	}
+	if err = checkDatapack(s, pack, force); err != nil {
+		return err
+	}
+
+	dir, err := s.DatapacksDir()
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	dest := filepath.Join(dir, pack.Name)
+	if _, err = os.Stat(dest); err == nil {
+		return fmt.Errorf("%s is already installed", pack.Name)
+	}
+
+	info, err := os.Stat(source)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		err = copyDir(source, dest)
+	} else {
+		err = copyFile(source, dest, 0644)
+	}
+	if err != nil {
+		return err
+	}
+
+	L.Ok.Printf("%s installed in \"%s\"\n", pack.Name, s.Name)
+	return nil
+}
+
+// AddDatapackFromModrinth installs the newest version of a Modrinth data pack
+// compatible with the server
+func AddDatapackFromModrinth(s *Server, project string, force bool, progress DownloadProgress) error {
+	if s.IsRunning() {
+		return ErrServerRunning
+	}
+
+	version, err := latestModrinthVersion(project, []string{modrinthDatapack}, s.Version.ID)
+	if err != nil {
+		return err
+	}
+
+	file, err := version.primaryFile()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.MkdirTemp("", "datapack-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	if err = checkIllegalPath(tmp, file.Filename); err != nil {
+		return err
+	}
+
+	L.Info.Printf("Downloading %s %s\n", project, version.VersionNumber)
+	path := filepath.Join(tmp, file.Filename)
+	if err = downloadFile(file.URL, path, file.checksum(), progress); err != nil {
+		return err
+	}
+
+	return AddDatapack(s, path, force)
+}
+
+// RemoveDatapack deletes an installed data pack
+func RemoveDatapack(s *Server, name string) error {
+	if s.IsRunning() {
+		return ErrServerRunning
+	}
+
+	dir, err := s.DatapacksDir()
+	if err != nil {
+		return err
+	}
+	if err = checkIllegalPath(dir, name); err != nil {
+		return err
+	}
+
+	path := filepath.Join(dir, name)
+	if _, err = os.Stat(path); err != nil {
+		// Allow to omit the extension
+		if _, zipErr := os.Stat(path + ".zip"); zipErr != nil || strings.HasSuffix(name, ".zip") {
+			return fmt.Errorf("%s is not installed", name)
+		}
+		path += ".zip"
+	}
+
+	if err = os.RemoveAll(path); err != nil {
+		return err
+	}
+	L.Ok.Printf("%s removed from \"%s\"\n", filepath.Base(path), s.Name)
+	return nil
+}
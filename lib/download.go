@@ -0,0 +1,241 @@
+package lib
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// DownloadProgress is notified while a file is being downloaded
+type DownloadProgress interface {
+	OnDownloadStart(size uint64, name string)
+	OnDownloadProgress(n int64)
+	OnDownloadFinish()
+}
+
+// silentDownload is used when the progress is reported in another way
+type silentDownload struct{}
+
+func (silentDownload) OnDownloadStart(uint64, string) {}
+func (silentDownload) OnDownloadProgress(int64)       {}
+func (silentDownload) OnDownloadFinish()              {}
+
+type checksum struct {
+	newHash func() hash.Hash
+	sum     string
+}
+
+func sha1Checksum(sum string) checksum   { return checksum{sha1.New, sum} }
+func sha256Checksum(sum string) checksum { return checksum{sha256.New, sum} }
+func sha512Checksum(sum string) checksum { return checksum{sha512.New, sum} }
+
+var noChecksum = checksum{}
+
+var ErrChecksumMismatch = errors.New("Checksum verification failed")
+
+const (
+	downloadRetries    = 4
+	downloadRetryDelay = 2 * time.Second
+	partialSuffix      = ".part"
+
+	// A transfer which receives nothing for this long is aborted, the next
+	// attempt resumes it
+	downloadIdleTimeout = 60 * time.Second
+)
+
+// downloadClient gives up on unreachable or unresponsive servers instead of
+// hanging forever like http.DefaultClient
+var downloadClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSHandshakeTimeout:   15 * time.Second,
+		ResponseHeaderTimeout: 30 * time.Second,
+		IdleConnTimeout:       90 * time.Second,
+	},
+}
+
+// idleReader closes the body when no data arrives for downloadIdleTimeout,
+// which makes the pending Read fail
+type idleReader struct {
+	body    io.ReadCloser
+	timer   *time.Timer
+	stalled int32
+}
+
+func newIdleReader(body io.ReadCloser) *idleReader {
+	r := &idleReader{body: body}
+	r.timer = time.AfterFunc(downloadIdleTimeout, func() {
+		atomic.StoreInt32(&r.stalled, 1)
+		r.body.Close()
+	})
+	return r
+}
+
+func (r *idleReader) Read(p []byte) (n int, err error) {
+	n, err = r.body.Read(p)
+	if n > 0 {
+		r.timer.Reset(downloadIdleTimeout)
+	}
+	if err != nil && atomic.LoadInt32(&r.stalled) == 1 {
+		err = fmt.Errorf("No data received for %s", downloadIdleTimeout)
+	}
+	return
+}
+
+func (r *idleReader) Stop() {
+	r.timer.Stop()
+}
+
+func (c checksum) verify(path string) error {
+	if c.sum == "" {
+		return nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	h := c.newHash()
+	if _, err = io.Copy(h, f); err != nil {
+		return err
+	}
+
+	if hex.EncodeToString(h.Sum(nil)) != c.sum {
+		return ErrChecksumMismatch
+	}
+	return nil
+}
+
+// downloadAttempt downloads url to partPath, continuing from where a
+// previous attempt stopped if the server supports range requests.
+func downloadAttempt(url string, partPath string, name string, started *bool, progress DownloadProgress) error {
+	var offset int64 = 0
+	if info, err := os.Stat(partPath); err == nil {
+		offset = info.Size()
+	}
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	res, err := downloadClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	flags := os.O_WRONLY | os.O_CREATE
+	switch res.StatusCode {
+	case http.StatusPartialContent:
+		L.Debug.Printf("Resuming download of %s from byte %d\n", name, offset)
+		flags |= os.O_APPEND
+	case http.StatusOK:
+		offset = 0
+		flags |= os.O_TRUNC
+	case http.StatusRequestedRangeNotSatisfiable:
+		// The partial file is already complete
+		return nil
+	default:
+		return fmt.Errorf("Unable to download %s: %s", name, res.Status)
+	}
+
+	if !*started {
+		size := uint64(0)
+		if res.ContentLength >= 0 {
+			size = uint64(offset + res.ContentLength)
+		}
+		progress.OnDownloadStart(size, name)
+		*started = true
+
+		// Resuming a download left over by a previous run
+		if offset > 0 {
+			progress.OnDownloadProgress(offset)
+		}
+	}
+
+	f, err := os.OpenFile(partPath, flags, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	kind := "file"
+	if filepath.Ext(name) == ".jar" {
+		kind = "jar"
+	}
+	body := newIdleReader(res.Body)
+	defer body.Stop()
+	pr := &progressReader{
+		body,
+		func(n int64) {
+			metricsDownloaded(kind, n)
+			progress.OnDownloadProgress(n)
+		},
+	}
+	if _, err = io.Copy(f, pr); err != nil {
+		return err
+	}
+
+	return f.Sync()
+}
+
+// downloadFile downloads url to dest, verifying its checksum.
+// The data is written to a temporary file next to dest which is renamed only
+// once the download is complete and verified, so dest is never truncated.
+// Failed downloads are retried, resuming from the partial file when possible.
+func downloadFile(url string, dest string, sum checksum, progress DownloadProgress) (err error) {
+	name := filepath.Base(dest)
+	partPath := dest + partialSuffix
+
+	started := false
+	defer func() {
+		if started {
+			progress.OnDownloadFinish()
+		}
+	}()
+
+	for attempt := 1; attempt <= downloadRetries; attempt++ {
+		if attempt > 1 {
+			delay := downloadRetryDelay * time.Duration(1<<(attempt-2))
+			L.Warn.Printf("Download of %s failed (%v), retrying in %s\n", name, err, delay)
+			time.Sleep(delay)
+		}
+
+		err = downloadAttempt(url, partPath, name, &started, progress)
+		if err != nil {
+			continue
+		}
+
+		err = sum.verify(partPath)
+		if err != nil {
+			// The partial file is corrupted, start again from scratch
+			os.Remove(partPath)
+			continue
+		}
+
+		return os.Rename(partPath, dest)
+	}
+
+	return fmt.Errorf("Unable to download %s after %d attempts: %v", name, downloadRetries, err)
+}
@@ -0,0 +1,71 @@
+package lib
+
+import (
+	"errors"
+	"path/filepath"
+	"time"
+)
+
+const (
+	EULAURL      = "https://aka.ms/MinecraftEULA"
+	eulaFileName = "eula.txt"
+)
+
+var ErrEULANotAccepted = errors.New("The Minecraft EULA (" + EULAURL + ") has not been accepted for this server")
+
+// HasAcceptedEULA reports whether the user agreed to the EULA once,
+// in which case it is accepted automatically for every server
+func HasAcceptedEULA() bool {
+	return !C.Minecraft.EULAAcceptedAt.IsZero()
+}
+
+// AcceptEULA remembers in the config that the user agreed to the EULA
+func AcceptEULA() error {
+	C.Minecraft.EULAAcceptedAt = time.Now()
+	L.Ok.Printf("EULA accepted on %s\n", C.Minecraft.EULAAcceptedAt.Format("2006-01-02"))
+	return WriteConfig()
+}
+
+func serverEULAAccepted(baseDir string) bool {
+	props, err := LoadProperties(filepath.Join(baseDir, eulaFileName))
+	if err != nil {
+		return false
+	}
+	return props.GetOr("eula", "false") == "true"
+}
+
+func writeServerEULA(baseDir string) error {
+	props := NewProperties()
+	props.Set("eula", "true")
+	return props.Save(filepath.Join(baseDir, eulaFileName))
+}
+
+// checkServerEULA accepts the EULA for the server if the user already agreed
+// to it, otherwise it returns ErrEULANotAccepted instead of letting the
+// server exit right after starting
+func checkServerEULA(s *Server) error {
+	if serverEULAAccepted(s.BaseDir) {
+		return nil
+	}
+	if NeedsEULA(s) {
+		return ErrEULANotAccepted
+	}
+
+	L.Info.Printf("Accepting the EULA for \"%s\"\n", s.Name)
+	return writeServerEULA(s.BaseDir)
+}
+
+// NeedsEULA reports whether the user has to agree to the EULA before the
+// server can start
+func NeedsEULA(s *Server) bool {
+	return !serverEULAAccepted(s.BaseDir) && (!HasAcceptedEULA() || C.Minecraft.NoEULA)
+}
+
+// AcceptServerEULA records the consent of the user and accepts the EULA for
+// the server
+func AcceptServerEULA(s *Server) error {
+	if err := AcceptEULA(); err != nil {
+		return err
+	}
+	return writeServerEULA(s.BaseDir)
+}
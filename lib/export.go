@@ -0,0 +1,284 @@
+package lib
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// ExportManifestName is the file added to the exported archives to describe
+// the server they contain
+const ExportManifestName = "server-tool-export.json"
+
+type ExportManifest struct {
+	Name             string
+	MinecraftVersion string
+	Type             string
+	JavaVersion      int `json:",omitempty"`
+
+	// Jar is set when the server jar was left out of the archive since it
+	// can be downloaded again, JarSHA1 is used to verify the download.
+	Jar     string `json:",omitempty"`
+	JarSHA1 string `json:",omitempty"`
+
+	ToolVersion string
+	Created     time.Time
+}
+
+var ErrUnsupportedArchive = errors.New("Unsupported archive format, use .tar.zst or .zip")
+
+func archiveFormat(name string) string {
+	for _, ext := range []string{".tar.zst", ".tar.gz", ".zip"} {
+		if strings.HasSuffix(strings.ToLower(name), ext) {
+			return ext
+		}
+	}
+	return ""
+}
+
+// isExcluded matches rel against the patterns. Like in .gitignore, patterns
+// without a slash match the name of the file in any folder.
+func isExcluded(rel string, patterns []string) bool {
+	for _, p := range patterns {
+		target := rel
+		if !strings.Contains(p, "/") {
+			target = path.Base(rel)
+		}
+		if ok, _ := path.Match(p, target); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// manifestFileInfo makes the in-memory manifest look like a file on disk
+type manifestFileInfo struct {
+	size    int64
+	modTime time.Time
+}
+
+func (i manifestFileInfo) Name() string       { return ExportManifestName }
+func (i manifestFileInfo) Size() int64        { return i.size }
+func (i manifestFileInfo) Mode() fs.FileMode  { return 0644 }
+func (i manifestFileInfo) ModTime() time.Time { return i.modTime }
+func (i manifestFileInfo) IsDir() bool        { return false }
+func (i manifestFileInfo) Sys() any           { return nil }
+
+// ExportServer writes the server to a .tar.zst or .zip archive, depending on
+// the extension of output. The files matching C.Export.Exclude are left out.
+func ExportServer(s *Server, output string) (err error) {
+	format := archiveFormat(output)
+	if format != ".tar.zst" && format != ".zip" {
+		return ErrUnsupportedArchive
+	}
+
+	if s.IsRunning() {
+		return ErrServerRunning
+	}
+
+	manifest := ExportManifest{
+		Name:             s.Name,
+		MinecraftVersion: s.Version.ID,
+		Type:             s.Type.String(),
+		JavaVersion:      s.JavaVersion(),
+		ToolVersion:      Version,
+		Created:          time.Now(),
+	}
+
+	// Jars that match the manifest can be downloaded again by the import
+	if s.Type != Paper && s.VersionStatus == VersionVerified && s.JarName != "" {
+		manifest.Jar = s.JarName
+		manifest.JarSHA1 = s.Version.SHA
+	}
+
+	manifestData, err := json.MarshalIndent(&manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		f.Close()
+		if err != nil {
+			os.Remove(output)
+		}
+	}()
+
+	var a archiveWriter
+	if format == ".zip" {
+		a = &zipArchive{zip.NewWriter(f)}
+	} else {
+		var zw *zstd.Encoder
+		if zw, err = zstd.NewWriter(f); err != nil {
+			return err
+		}
+		a = newTarArchive(zw)
+	}
+
+	L.Info.Printf("Exporting \"%s\" to %s\n", s.Name, output)
+
+	info := manifestFileInfo{int64(len(manifestData)), manifest.Created}
+	if err = a.writeFile(ExportManifestName, info, bytes.NewReader(manifestData)); err != nil {
+		return err
+	}
+
+	err = addTree(a, s.BaseDir, func(rel string) bool {
+		return rel == lockFileName ||
+			rel == ExportManifestName ||
+			rel == manifest.Jar ||
+			isExcluded(rel, C.Export.Exclude)
+	})
+	if err != nil {
+		return err
+	}
+
+	if err = a.Close(); err != nil {
+		return err
+	}
+
+	L.Ok.Printf("\"%s\" exported to %s\n", s.Name, output)
+	return nil
+}
+
+func extractArchive(archive string, dest string) error {
+	f, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	onProgress := func(name string) { L.Debug.Printf("Extracted %s\n", name) }
+
+	switch archiveFormat(archive) {
+	case ".tar.zst":
+		return Untarzst(f, dest, "", onProgress)
+	case ".tar.gz":
+		return Untargz(f, dest, "", onProgress)
+	case ".zip":
+		info, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		return Unzip(f, info.Size(), dest, "", onProgress)
+	}
+	return ErrUnsupportedArchive
+}
+
+func readExportManifest(dir string) (*ExportManifest, error) {
+	b, err := os.ReadFile(filepath.Join(dir, ExportManifestName))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	manifest := &ExportManifest{}
+	if err = json.Unmarshal(b, manifest); err != nil {
+		return nil, fmt.Errorf("Invalid %s: %v", ExportManifestName, err)
+	}
+	return manifest, nil
+}
+
+// ImportServer unpacks an archive created by ExportServer in the working
+// directory and downloads the server jar if it was not included.
+// If name is empty the name stored in the archive is used.
+func ImportServer(archive string, name string, manifestProgress ManifestDownloadProgress, progress DownloadProgress) error {
+	if archiveFormat(archive) == "" {
+		return ErrUnsupportedArchive
+	}
+
+	if err := os.MkdirAll(C.Application.WorkingDir, 0755); err != nil {
+		return err
+	}
+
+	// Extract to a temporary folder first since the name could be in the archive
+	tmp, err := os.MkdirTemp(C.Application.WorkingDir, ".import-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	L.Info.Printf("Extracting %s\n", archive)
+	if err = extractArchive(archive, tmp); err != nil {
+		return err
+	}
+
+	manifest, err := readExportManifest(tmp)
+	if err != nil {
+		return err
+	}
+	if manifest == nil {
+		L.Warn.Printf("%s has no %s, importing it as it is\n", archive, ExportManifestName)
+		manifest = &ExportManifest{}
+	}
+	os.Remove(filepath.Join(tmp, ExportManifestName))
+
+	if name == "" {
+		name = manifest.Name
+	}
+	if name == "" {
+		name = strings.TrimSuffix(filepath.Base(archive), archiveFormat(archive))
+	}
+
+	dest, err := validateServerName(name)
+	if err != nil {
+		return err
+	}
+
+	if manifest.Jar != "" {
+		if err = checkIllegalPath(tmp, manifest.Jar); err != nil {
+			return err
+		}
+
+		jarPath := filepath.Join(tmp, manifest.Jar)
+		if _, err = os.Stat(jarPath); errors.Is(err, os.ErrNotExist) {
+			version, err := FindVersion(manifest.MinecraftVersion, manifestProgress)
+			if err != nil {
+				return err
+			}
+			if version.SHA != manifest.JarSHA1 {
+				return fmt.Errorf("The jar of %s does not match the one of the exported server", version.ID)
+			}
+
+			L.Info.Printf("Downloading server jar for version %s\n", version.ID)
+			err = downloadFile(version.JarURL, jarPath, sha1Checksum(manifest.JarSHA1), progress)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	settings, err := LoadServerSettings(tmp)
+	if err != nil {
+		return err
+	}
+	// Remember the Java version in case the jar cannot be recognized
+	if settings.JavaVersion == 0 && manifest.JavaVersion != 0 {
+		s := Server{BaseDir: tmp, Settings: settings}
+		s.Settings.JavaVersion = manifest.JavaVersion
+		if err = s.SaveSettings(); err != nil {
+			return err
+		}
+	}
+
+	if err = os.Rename(tmp, dest); err != nil {
+		return err
+	}
+
+	L.Ok.Printf("\"%s\" imported\n", name)
+	return nil
+}
@@ -0,0 +1,80 @@
+package lib
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+
+	"github.com/Jeffail/gabs/v2"
+)
+
+const (
+	fabricMetaURL           = "https://meta.fabricmc.net/v2/versions"
+	fabricLoadersURL        = fabricMetaURL + "/loader/%s"
+	fabricInstallersURL     = fabricMetaURL + "/installer"
+	fabricServerLauncherURL = fabricMetaURL + "/loader/%s/%s/%s/server/jar"
+)
+
+func getFabricJSON(url string) (*gabs.Container, error) {
+	res, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Unable to get %s: %s", url, res.Status)
+	}
+	return gabs.ParseJSONBuffer(res.Body)
+}
+
+// latestFabricVersions returns the latest loader for gameVersion, unless
+// loader is already set, and the latest stable installer
+func latestFabricVersions(gameVersion string, loader string) (string, string, error) {
+	loaders, err := getFabricJSON(fmt.Sprintf(fabricLoadersURL, gameVersion))
+	if err != nil {
+		return "", "", err
+	}
+	if len(loaders.Children()) == 0 {
+		return "", "", fmt.Errorf("Fabric does not support Minecraft %s", gameVersion)
+	}
+	if loader == "" {
+		loader, _ = loaders.Children()[0].Search("loader", "version").Data().(string)
+	}
+
+	installer := ""
+
+	installers, err := getFabricJSON(fabricInstallersURL)
+	if err != nil {
+		return "", "", err
+	}
+	for _, i := range installers.Children() {
+		if stable, _ := i.Search("stable").Data().(bool); stable {
+			installer, _ = i.Search("version").Data().(string)
+			break
+		}
+	}
+
+	if loader == "" || installer == "" {
+		return "", "", fmt.Errorf("Unable to find a Fabric loader for Minecraft %s", gameVersion)
+	}
+	return loader, installer, nil
+}
+
+// InstallFabric downloads the Fabric server launcher, which runs server.jar
+// with the Fabric loader. If loader is empty the latest one is used.
+func InstallFabric(s *Server, loader string, progress DownloadProgress) error {
+	loader, installer, err := latestFabricVersions(s.Version.ID, loader)
+	if err != nil {
+		return err
+	}
+
+	L.Info.Printf("Downloading Fabric loader %s for Minecraft %s\n", loader, s.Version.ID)
+	url := fmt.Sprintf(fabricServerLauncherURL, s.Version.ID, loader, installer)
+	if err = downloadFile(url, filepath.Join(s.BaseDir, FabricJarName), noChecksum, progress); err != nil {
+		return err
+	}
+
+	s.Type = Fabric
+	return nil
+}
@@ -1,6 +1,7 @@
 package lib
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
@@ -45,6 +46,161 @@ const (
 	lockFileName = "__lock"
 )
 
+type UnfuckKind uint8
+
+const (
+	UnfuckKindCommit UnfuckKind = iota
+	UnfuckKindReset
+	UnfuckKindRemoveLock
+)
+
+// UnfuckPreview describes what an unfuck operation is going to do
+type UnfuckPreview struct {
+	Kind        UnfuckKind
+	Deleted     []string
+	Overwritten []string
+	Committed   []string
+	LostCommits []string
+	LockHolder  string
+}
+
+const maxPreviewLines = 15
+
+func (p *UnfuckPreview) String() string {
+	b := strings.Builder{}
+	section := func(title string, lines []string) {
+		if len(lines) == 0 {
+			return
+		}
+		fmt.Fprintf(&b, "%s (%d):\n", title, len(lines))
+		for i, l := range lines {
+			if i == maxPreviewLines {
+				fmt.Fprintf(&b, "  ... and %d more\n", len(lines)-maxPreviewLines)
+				break
+			}
+			fmt.Fprintf(&b, "  %s\n", l)
+		}
+	}
+
+	section("Files that will be deleted", p.Deleted)
+	section("Files that will be overwritten", p.Overwritten)
+	section("Files that will be committed", p.Committed)
+	section("Commits that will be lost", p.LostCommits)
+	if p.LockHolder != "" {
+		fmt.Fprintf(&b, "The lock held by %s will be removed\n", p.LockHolder)
+	}
+
+	if b.Len() == 0 {
+		return "Nothing will be changed\n"
+	}
+	return b.String()
+}
+
+func gitOutputLines(baseDir string, args ...string) ([]string, error) {
+	out, err := gitOutput(baseDir, args...)
+	if err != nil || out == "" {
+		return []string{}, err
+	}
+	return strings.Split(strings.ReplaceAll(out, "\r", ""), "\n"), nil
+}
+
+// resetTarget is the ref a reset brings the server back to
+func resetTarget(baseDir string) string {
+	upstream, err := gitOutput(baseDir, "rev-parse", "--abbrev-ref", "--symbolic-full-name", "@{u}")
+	if err != nil || upstream == "" {
+		return "origin/master"
+	}
+	return upstream
+}
+
+func readLockHolder(baseDir string) string {
+	b, err := os.ReadFile(filepath.Join(baseDir, lockFileName))
+	if err != nil {
+		return ""
+	}
+	holder := strings.TrimSpace(string(b))
+	if holder == "" {
+		holder = "????"
+	}
+	return holder
+}
+
+// PreviewUnfuck computes what an unfuck operation would do without changing
+// anything but the remote tracking branches.
+func PreviewUnfuck(baseDir string, kind UnfuckKind) (*UnfuckPreview, error) {
+	if !hasGit {
+		return nil, ErrGitNotInstalled
+	}
+
+	preview := &UnfuckPreview{Kind: kind}
+
+	switch kind {
+	case UnfuckKindCommit:
+		status, err := gitOutputLines(baseDir, "status", "--porcelain", "--untracked-files=all")
+		if err != nil {
+			return nil, err
+		}
+		for _, l := range status {
+			if len(l) > 3 && !strings.HasSuffix(l, lockFileName) {
+				preview.Committed = append(preview.Committed, l[3:])
+			}
+		}
+		preview.LockHolder = readLockHolder(baseDir)
+
+	case UnfuckKindReset:
+		removed, err := gitOutputLines(baseDir, "clean", "-ndx")
+		if err != nil {
+			return nil, err
+		}
+		for _, l := range removed {
+			preview.Deleted = append(preview.Deleted, strings.TrimPrefix(l, "Would remove "))
+		}
+
+		preview.Overwritten, err = gitOutputLines(baseDir, "diff", "--name-only", "HEAD")
+		if err != nil {
+			return nil, err
+		}
+
+		remote, err := hasRemotes(baseDir)
+		if err != nil {
+			return nil, err
+		}
+		if remote {
+			if err = RunCmdPretty(baseDir, "git", "fetch", "--all"); err != nil {
+				return nil, err
+			}
+			target := resetTarget(baseDir)
+
+			changed, err := gitOutputLines(baseDir, "diff", "--name-only", "HEAD", target)
+			if err != nil {
+				return nil, err
+			}
+			for _, c := range changed {
+				found := false
+				for _, o := range preview.Overwritten {
+					if o == c {
+						found = true
+						break
+					}
+				}
+				if !found {
+					preview.Overwritten = append(preview.Overwritten, c)
+				}
+			}
+
+			preview.LostCommits, err = gitOutputLines(baseDir, "log", "--format=%h %an: %s", target+"..HEAD")
+			if err != nil {
+				return nil, err
+			}
+		}
+
+	case UnfuckKindRemoveLock:
+		preview.LockHolder = readLockHolder(baseDir)
+	}
+
+	return preview, nil
+}
+
 func UnfuckReset(baseDir string) error {
 	if !C.Git.Enable {
 		return nil
@@ -52,7 +208,12 @@ func UnfuckReset(baseDir string) error {
 
 	L.Warn.Println("Unfuck: reset")
 
-	err := RunCmdPretty(baseDir, "git", "reset", "--hard")
+	_, err := createSnapshot(baseDir)
+	if err != nil {
+		return err
+	}
+
+	err = RunCmdPretty(baseDir, "git", "reset", "--hard")
 	if err != nil {
 		return err
 	}
@@ -73,8 +234,7 @@ func UnfuckReset(baseDir string) error {
 			return err
 		}
 
-		// FIXME: we assume the name of the branches here
-		err = RunCmdPretty(baseDir, "git", "reset", "--hard", "origin/master")
+		err = RunCmdPretty(baseDir, "git", "reset", "--hard", resetTarget(baseDir))
 		if err != nil {
 			return err
 		}
@@ -90,8 +250,13 @@ func UnfuckCommit(baseDir string) error {
 
 	L.Warn.Println("Unfuck: manual commit")
 
+	_, err := createSnapshot(baseDir)
+	if err != nil {
+		return err
+	}
+
 	// Remove lock if present
-	err := RunCmdPretty(baseDir, "git", "rm", "-f", "--ignore-unmatch", lockFileName)
+	err = RunCmdPretty(baseDir, "git", "rm", "-f", "--ignore-unmatch", lockFileName)
 	if err != nil {
 		return err
 	}
@@ -117,7 +282,12 @@ func UnfuckRemoveLock(baseDir string) error {
 
 	L.Warn.Println("Unfuck: remove lock")
 
-	err := RunCmdPretty(baseDir, "git", "rm", "-f", "--ignore-unmatch", lockFileName)
+	_, err := createSnapshot(baseDir)
+	if err != nil {
+		return err
+	}
+
+	err = RunCmdPretty(baseDir, "git", "rm", "-f", "--ignore-unmatch", lockFileName)
 	if err != nil {
 		return err
 	}
@@ -138,7 +308,7 @@ func getGitUsername() (string, error) {
 	return strings.TrimSpace(string(name)), err
 }
 
-func PreFn(baseDir string, progress GitProgress) (err error) {
+func PreFn(baseDir string, progress GitProgress, resolver DivergenceResolver) (err error) {
 	if !C.Git.Enable {
 		return nil
 	}
@@ -155,9 +325,16 @@ func PreFn(baseDir string, progress GitProgress) (err error) {
 		return err
 	}
 
+	if remotes && HasPendingPush(baseDir) {
+		dialog("Pushing unsynced changes")
+		if err = pushOrQueue(baseDir); err != nil {
+			return err
+		}
+	}
+
 	if remotes {
 		dialog("Pulling latest changes")
-		err = RunCmdPretty(baseDir, "git", "pull")
+		err = pullLatest(baseDir, resolver)
 		if err != nil {
 			return err
 		}
@@ -219,6 +396,233 @@ func PreFn(baseDir string, progress GitProgress) (err error) {
 	return nil
 }
 
+type DivergenceChoice uint8
+
+const (
+	DivergenceAbort DivergenceChoice = iota
+	DivergenceKeepRemote
+	DivergenceKeepLocalAsBranch
+)
+
+// DivergenceResolver is asked what to do when both the local and the remote
+// branch have commits the other one does not have.
+type DivergenceResolver func(ahead, behind int) (DivergenceChoice, error)
+
+var (
+	ErrDivergenceAborted = errors.New("The local and remote history have diverged, aborting")
+)
+
+const localBranchPrefix = "server-tool/local-"
+
+func gitOutput(baseDir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	addSysProcAttr(cmd)
+	cmd.Dir = baseDir
+	out, err := cmd.Output()
+	return strings.TrimSpace(string(out)), err
+}
+
+// Longest time a fetch done only to show the status can take
+const statusFetchTimeout = 15 * time.Second
+
+// fetchNonInteractive fetches the remote without ever asking for credentials,
+// so that an offline host or a missing login cannot hang the server list
+func fetchNonInteractive(baseDir string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), statusFetchTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "git", "fetch", "--quiet")
+	addSysProcAttr(cmd)
+	cmd.Dir = baseDir
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	if os.Getenv("GIT_SSH_COMMAND") == "" {
+		cmd.Env = append(cmd.Env, "GIT_SSH_COMMAND=ssh -o BatchMode=yes")
+	}
+
+	err := cmd.Run()
+	if ctx.Err() != nil {
+		return fmt.Errorf("Timed out after %v", statusFetchTimeout)
+	}
+	return err
+}
+
+func aheadBehind(baseDir string, upstream string) (ahead int, behind int, err error) {
+	out, err := gitOutput(baseDir, "rev-list", "--left-right", "--count", "HEAD..."+upstream)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	_, err = fmt.Sscanf(out, "%d %d", &ahead, &behind)
+	return
+}
+
+// pullLatest brings the local branch up to date with its upstream without
+// ever creating a merge commit. If the histories have diverged the resolver
+// decides which side to keep.
+func pullLatest(baseDir string, resolver DivergenceResolver) error {
+	if _, err := gitOutput(baseDir, "rev-parse", "-q", "--verify", "MERGE_HEAD"); err == nil {
+		L.Warn.Println("A previous merge was left unfinished, aborting it")
+		if err = RunCmdPretty(baseDir, "git", "merge", "--abort"); err != nil {
+			return err
+		}
+	}
+
+	err := RunCmdPretty(baseDir, "git", "fetch")
+	if err != nil {
+		return err
+	}
+
+	upstream, err := gitOutput(baseDir, "rev-parse", "--abbrev-ref", "--symbolic-full-name", "@{u}")
+	if err != nil || upstream == "" {
+		return fmt.Errorf("The current branch has no upstream. Set one with \"git branch -u\" and try again")
+	}
+
+	ahead, behind, err := aheadBehind(baseDir, upstream)
+	if err != nil {
+		return err
+	}
+	L.Debug.Printf("Local branch is %d commits ahead and %d commits behind %s\n", ahead, behind, upstream)
+
+	if behind == 0 {
+		return nil
+	}
+
+	if ahead == 0 {
+		return RunCmdPretty(baseDir, "git", "merge", "--ff-only", upstream)
+	}
+
+	L.Warn.Printf("The local history has diverged from %s (%d local, %d remote commits)\n", upstream, ahead, behind)
+
+	choice := DivergenceAbort
+	if resolver != nil {
+		choice, err = resolver(ahead, behind)
+		if err != nil {
+			return err
+		}
+	}
+
+	switch choice {
+	case DivergenceKeepRemote:
+		L.Warn.Printf("Discarding %d local commits\n", ahead)
+	case DivergenceKeepLocalAsBranch:
+		branch := localBranchPrefix + strings.ReplaceAll(time.Now().Format(time.RFC3339), ":", "-")
+		L.Info.Printf("Saving the local commits to the branch %s\n", branch)
+		if err = RunCmdPretty(baseDir, "git", "branch", branch); err != nil {
+			return err
+		}
+
+		remote := strings.SplitN(upstream, "/", 2)[0]
+		if err = RunCmdPretty(baseDir, "git", "push", remote, branch); err != nil {
+			L.Warn.Printf("Unable to push %s, it is only available locally: %v\n", branch, err)
+		}
+	default:
+		return ErrDivergenceAborted
+	}
+
+	// Uncommitted changes, like the world of a crashed run, would be lost
+	changes, err := gitOutput(baseDir, "status", "--porcelain")
+	if err != nil {
+		return err
+	}
+	if changes != "" {
+		snap, err := createSnapshot(baseDir)
+		if err != nil {
+			return fmt.Errorf("Unable to save the uncommitted changes before discarding them: %v", err)
+		}
+		L.Warn.Printf("The uncommitted changes were saved to snapshot %s\n", snap.Name())
+	}
+
+	err = RunCmdPretty(baseDir, "git", "reset", "--hard", upstream)
+	if err != nil {
+		return err
+	}
+
+	// The local commits are not on this branch anymore, there is nothing left to push
+	return dequeuePush(baseDir)
+}
+
+// GitStatus is a summary of the state of a server repository
+type GitStatus struct {
+	LockedBy string
+	Ahead    int
+	Behind   int
+	Dirty    bool
+}
+
+// ReadGitStatus looks at the lock and at how the local branch compares to
+// its upstream. If fetch is true the remote is fetched first so that the
+// information is up to date, a failing fetch is not an error.
+func ReadGitStatus(baseDir string, fetch bool) (status GitStatus, err error) {
+	if !hasGit {
+		return status, ErrGitNotInstalled
+	}
+
+	remotes, err := hasRemotes(baseDir)
+	if err != nil {
+		return status, err
+	}
+
+	if remotes && fetch {
+		if err := fetchNonInteractive(baseDir); err != nil {
+			L.Warn.Printf("Unable to fetch \"%s\": %v\n", baseDir, err)
+		}
+	}
+
+	status.LockedBy = readLockHolder(baseDir)
+
+	upstream, err := gitOutput(baseDir, "rev-parse", "--abbrev-ref", "--symbolic-full-name", "@{u}")
+	if remotes && err == nil && upstream != "" {
+		status.Ahead, status.Behind, err = aheadBehind(baseDir, upstream)
+		if err != nil {
+			return status, err
+		}
+
+		// The remote lock is the one that matters, the local one could be ours
+		if lock, err := gitOutput(baseDir, "show", upstream+":"+lockFileName); err == nil {
+			status.LockedBy = lock
+			if lock == "" {
+				status.LockedBy = "????"
+			}
+		} else if status.LockedBy != "" && status.Ahead == 0 {
+			// We have a lock that is not on the remote and nothing to push,
+			// someone removed it.
+			status.LockedBy = ""
+		}
+	}
+
+	changes, err := gitOutput(baseDir, "status", "--porcelain")
+	if err != nil {
+		return status, err
+	}
+	status.Dirty = changes != ""
+
+	return status, nil
+}
+
+// releaseLock removes the lock acquired by PreFn without committing anything
+// else. It is used when an operation fails before changing the server.
+func releaseLock(baseDir string) error {
+	if !C.Git.UseLockFile {
+		return nil
+	}
+
+	err := RunCmdPretty(baseDir, "git", "rm", "-f", "--ignore-unmatch", lockFileName)
+	if err != nil {
+		return err
+	}
+
+	err = RunCmdPretty(baseDir, "git", "commit", "-m", "Releasing lock")
+	if err != nil {
+		return err
+	}
+
+	remotes, err := hasRemotes(baseDir)
+	if err != nil || !remotes {
+		return err
+	}
+	return pushOrQueue(baseDir)
+}
+
 func hasRemotes(baseDir string) (bool, error) {
 	cmd := exec.Command("git", "remote")
 	addSysProcAttr(cmd)
@@ -260,11 +664,8 @@ func PostFn(baseDir string, progress GitProgress) (err error) {
 	dialog("Committing files")
 
 	msg := ""
-	if serverStartTime != nil {
-		msg = fmt.Sprintf("Server started at %s\n\nTime played: %s\nserver-tool version: %s",
-			serverStartTime.Format(time.RFC3339),
-			time.Since(*serverStartTime).String(),
-			Version)
+	if currentSession != nil {
+		msg = currentSession.commitMessage()
 	} else {
 		msg = fmt.Sprintf("Unknown server start time\n\nserver-tool version: %s", Version)
 	}
@@ -282,7 +683,7 @@ func PostFn(baseDir string, progress GitProgress) (err error) {
 
 	if remotes {
 		dialog("Pushing files")
-		err = RunCmdPretty(baseDir, "git", "push")
+		err = pushOrQueue(baseDir)
 	}
 	return err
 }
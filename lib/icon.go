@@ -0,0 +1,80 @@
+package lib
+
+import (
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+
+	// Formats accepted by SetServerIcon
+	_ "image/gif"
+	_ "image/jpeg"
+
+	"golang.org/x/image/draw"
+)
+
+const (
+	ServerIconFileName = "server-icon.png"
+	// Minecraft ignores icons of any other size
+	serverIconSize = 64
+)
+
+// squareCrop returns the largest square in the center of r
+func squareCrop(r image.Rectangle) image.Rectangle {
+	size := r.Dx()
+	if r.Dy() < size {
+		size = r.Dy()
+	}
+
+	min := image.Pt(r.Min.X+(r.Dx()-size)/2, r.Min.Y+(r.Dy()-size)/2)
+	return image.Rectangle{Min: min, Max: min.Add(image.Pt(size, size))}
+}
+
+// SetServerIcon crops the image to a square, scales it to 64x64 and saves it
+// as the icon of the server
+func SetServerIcon(s *Server, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	src, format, err := image.Decode(f)
+	if err != nil {
+		return fmt.Errorf("Unable to read %s: %v", filepath.Base(path), err)
+	}
+
+	bounds := src.Bounds()
+	if bounds.Dx() != bounds.Dy() {
+		L.Info.Printf("%s is %dx%d, the sides will be cropped\n", filepath.Base(path), bounds.Dx(), bounds.Dy())
+	}
+	L.Debug.Printf("Scaling a %dx%d %s to %dx%d\n", bounds.Dx(), bounds.Dy(), format, serverIconSize, serverIconSize)
+
+	dst := image.NewRGBA(image.Rect(0, 0, serverIconSize, serverIconSize))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, squareCrop(bounds), draw.Src, nil)
+
+	out, err := os.Create(filepath.Join(s.BaseDir, ServerIconFileName))
+	if err != nil {
+		return err
+	}
+	if err = png.Encode(out, dst); err != nil {
+		out.Close()
+		return err
+	}
+	if err = out.Close(); err != nil {
+		return err
+	}
+
+	L.Ok.Printf("Icon of \"%s\" changed\n", s.Name)
+	return nil
+}
+
+// RemoveServerIcon deletes the icon, the default one is shown instead
+func RemoveServerIcon(s *Server) error {
+	err := os.Remove(filepath.Join(s.BaseDir, ServerIconFileName))
+	if os.IsNotExist(err) {
+		return fmt.Errorf("\"%s\" has no icon", s.Name)
+	}
+	return err
+}
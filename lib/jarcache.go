@@ -0,0 +1,158 @@
+package lib
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// jarCacheEntry is the result of the detection of a server jar.
+// It is valid as long as the size and modification time of the jar do not
+// change. The jars that were not found in the manifest are checked again when
+// the manifest changes.
+type jarCacheEntry struct {
+	Size    int64
+	ModTime time.Time
+	SHA1    string
+	// Modification time of the manifest the jar was looked up in
+	ManifestModTime time.Time
+
+	// Recognized is false if neither the manifest nor the jar metadata
+	// could tell anything about the jar, in that case Version is nil.
+	Recognized bool
+	Version    *VersionInfo
+	Status     VersionStatus
+	IsPaper    bool
+}
+
+type jarCache struct {
+	entries map[string]jarCacheEntry
+	dirty   bool
+	// Modification time of the manifest when the cache was loaded
+	manifestModTime time.Time
+	sync.Mutex
+}
+
+func JarCachePath() string { return filepath.Join(C.Application.CacheDir, "jar-cache.json") }
+
+func jarCacheKey(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	return abs
+}
+
+// manifestModTime is the zero time if the manifest was never downloaded
+func manifestModTime() time.Time {
+	info, err := os.Stat(ManifestPath())
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+func loadJarCache() *jarCache {
+	c := &jarCache{
+		entries:         map[string]jarCacheEntry{},
+		manifestModTime: manifestModTime(),
+	}
+
+	f, err := os.Open(JarCachePath())
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			L.Warn.Printf("Unable to open the jar cache: %v\n", err)
+		}
+		return c
+	}
+	defer f.Close()
+
+	if err = json.NewDecoder(f).Decode(&c.entries); err != nil {
+		L.Warn.Println("The jar cache is corrupted, it will be rebuilt")
+		c.entries = map[string]jarCacheEntry{}
+	}
+	return c
+}
+
+func (c *jarCache) get(path string, info os.FileInfo) (jarCacheEntry, bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	e, ok := c.entries[jarCacheKey(path)]
+	if !ok || e.Size != info.Size() || !e.ModTime.Equal(info.ModTime()) {
+		return jarCacheEntry{}, false
+	}
+	// A newer manifest could contain the jar
+	if e.Status != VersionVerified && !e.ManifestModTime.Equal(c.manifestModTime) {
+		return jarCacheEntry{}, false
+	}
+	return e, true
+}
+
+func (c *jarCache) put(path string, e jarCacheEntry) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.entries[jarCacheKey(path)] = e
+	c.dirty = true
+}
+
+func (c *jarCache) save() error {
+	c.Lock()
+	defer c.Unlock()
+
+	if !c.dirty {
+		return nil
+	}
+
+	// Forget the jars that do not exist anymore
+	for path := range c.entries {
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			delete(c.entries, path)
+		}
+	}
+
+	f, err := os.Create(JarCachePath())
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	c.dirty = false
+	return json.NewEncoder(f).Encode(c.entries)
+}
+
+func hashFileSHA1(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hasher := sha1.New()
+	if _, err = io.Copy(hasher, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// lazyManifest downloads or reads the manifest only the first time it is needed
+type lazyManifest struct {
+	once     sync.Once
+	infos    []VersionInfo
+	err      error
+	progress ManifestDownloadProgress
+}
+
+func (m *lazyManifest) get() ([]VersionInfo, error) {
+	m.once.Do(func() {
+		m.infos, m.err = GetVersionInfos(m.progress)
+	})
+	return m.infos, m.err
+}
@@ -0,0 +1,146 @@
+package lib
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+// jarMetadata is what can be learned about a server by looking inside its jar
+type jarMetadata struct {
+	VersionID   string
+	JavaVersion int
+	IsPaper     bool
+	// 0 if the jar does not say which data pack format it supports
+	DataPackFormat int
+}
+
+const (
+	jarVersionFile     = "version.json"
+	jarVersionsList    = "META-INF/versions.list"
+	jarManifest        = "META-INF/MANIFEST.MF"
+	fabricInstallProps = "install.properties"
+	paperclipPackage   = "io/papermc/paperclip/"
+	paperVersionPrefix = "paper-"
+)
+
+func readZipFile(f *zip.File) ([]byte, error) {
+	r, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// readJarMetadata looks for the files that the vanilla, Paper and Fabric jars
+// use to describe themselves. It returns nil if none of them was found.
+func readJarMetadata(jarPath string) (*jarMetadata, error) {
+	r, err := zip.OpenReader(jarPath)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	meta := &jarMetadata{}
+	found := false
+
+	for _, f := range r.File {
+		switch {
+		case f.Name == jarVersionFile:
+			b, err := readZipFile(f)
+			if err != nil {
+				return nil, err
+			}
+
+			var v struct {
+				ID          string          `json:"id"`
+				JavaVersion int             `json:"java_version"`
+				PackVersion json.RawMessage `json:"pack_version"`
+			}
+			if err = json.Unmarshal(b, &v); err != nil {
+				L.Debug.Printf("Invalid %s in %s: %v\n", jarVersionFile, jarPath, err)
+				continue
+			}
+			meta.VersionID = v.ID
+			meta.JavaVersion = v.JavaVersion
+			meta.DataPackFormat = parsePackVersion(v.PackVersion)
+			found = true
+
+		case f.Name == jarVersionsList:
+			// Lines are "<sha256>\t<id>\t<path>", Paper uses "paper-<version>" as id
+			b, err := readZipFile(f)
+			if err != nil {
+				return nil, err
+			}
+
+			scanner := bufio.NewScanner(strings.NewReader(string(b)))
+			for scanner.Scan() {
+				fields := strings.Split(scanner.Text(), "\t")
+				if len(fields) == 3 && strings.HasPrefix(fields[1], paperVersionPrefix) {
+					meta.IsPaper = true
+					if meta.VersionID == "" {
+						meta.VersionID = strings.TrimPrefix(fields[1], paperVersionPrefix)
+					}
+					found = true
+				}
+			}
+
+		case f.Name == fabricInstallProps:
+			b, err := readZipFile(f)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, line := range strings.Split(string(b), "\n") {
+				key, value, ok := parsePropertyLine(strings.TrimRight(line, "\r"))
+				if ok && key == "game-version" && meta.VersionID == "" {
+					meta.VersionID = value
+					found = true
+				}
+			}
+
+		case f.Name == jarManifest:
+			b, err := readZipFile(f)
+			if err != nil {
+				return nil, err
+			}
+			if strings.Contains(string(b), "Main-Class: io.papermc.paperclip") {
+				meta.IsPaper = true
+				found = true
+			}
+
+		case strings.HasPrefix(f.Name, paperclipPackage):
+			meta.IsPaper = true
+			found = true
+		}
+	}
+
+	if !found {
+		return nil, nil
+	}
+	return meta, nil
+}
+
+// parsePackVersion reads the pack_version of version.json, which is a number
+// up to 1.19 and an object with the resource and data pack formats after
+func parsePackVersion(raw json.RawMessage) int {
+	var n int
+	if err := json.Unmarshal(raw, &n); err == nil {
+		return n
+	}
+
+	var formats struct {
+		Data      int `json:"data"`
+		DataMajor int `json:"data_major"`
+	}
+	if err := json.Unmarshal(raw, &formats); err != nil {
+		return 0
+	}
+	if formats.DataMajor != 0 {
+		return formats.DataMajor
+	}
+	return formats.Data
+}
@@ -28,9 +28,7 @@ func JavaDir() string     { return path.Join(C.Application.CacheDir, "java") }
 func javaExePath() string { return path.Join("bin", javaExeName()) }
 
 type JavaDownloadProgress interface {
-	OnDownloadStart(size uint64, name string)
-	OnDownloadProgress(n int64)
-	OnDownloadFinish()
+	DownloadProgress
 	OnExtractionStart(name string)
 	OnExtractionProgress(name string)
 	OnExtractionDone()
@@ -99,7 +97,10 @@ func installJava(javaVersion int, progress JavaDownloadProgress) error {
 
 	pr := &progressReader{
 		res.Body,
-		progress.OnDownloadProgress,
+		func(n int64) {
+			metricsDownloaded("java", n)
+			progress.OnDownloadProgress(n)
+		},
 	}
 	_, err = io.Copy(tmp, pr)
 	if err != nil {
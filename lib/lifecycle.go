@@ -0,0 +1,315 @@
+package lib
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A TrashEntry is a server that was deleted and can still be restored
+type TrashEntry struct {
+	ID           string
+	Name         string
+	OriginalPath string
+	DeletedAt    time.Time
+}
+
+const (
+	trashIndexName = "trash.json"
+	trashExpiry    = 30 * 24 * time.Hour
+)
+
+var (
+	ErrServerRunning = errors.New("The server is running, stop it and try again")
+)
+
+func TrashDir() string   { return filepath.Join(C.Application.CacheDir, "trash") }
+func runningDir() string { return filepath.Join(C.Application.CacheDir, "running") }
+
+func runningMarkerPath(baseDir string) string {
+	h := sha1.Sum([]byte(pushQueueKey(baseDir)))
+	return filepath.Join(runningDir(), hex.EncodeToString(h[:]))
+}
+
+// markRunning records that this process is running the server in baseDir.
+// The returned function removes the mark.
+func markRunning(baseDir string) func() {
+	path := runningMarkerPath(baseDir)
+	err := os.MkdirAll(runningDir(), 0700)
+	if err == nil {
+		err = os.WriteFile(path, []byte(strconv.Itoa(os.Getpid())), 0600)
+	}
+	if err != nil {
+		L.Warn.Printf("Unable to mark \"%s\" as running: %v\n", baseDir, err)
+	}
+
+	return func() {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			L.Warn.Printf("Unable to remove the running mark of \"%s\": %v\n", baseDir, err)
+		}
+	}
+}
+
+// IsRunning reports whether the server is being run by an instance of
+// server-tool on this machine
+func (s *Server) IsRunning() bool {
+	b, err := os.ReadFile(runningMarkerPath(s.BaseDir))
+	if err != nil {
+		return false
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil {
+		return false
+	}
+	return processExists(pid)
+}
+
+func (s *Server) checkCanBeChanged() error {
+	if s.IsRunning() {
+		return ErrServerRunning
+	}
+	if s.HasGit && s.GitStatus.LockedBy != "" {
+		return fmt.Errorf("\"%s\" is locked by %s", s.Name, s.GitStatus.LockedBy)
+	}
+	if readLockHolder(s.BaseDir) != "" {
+		return fmt.Errorf("\"%s\" has a lock file, remove it first", s.Name)
+	}
+	return nil
+}
+
+func validateServerName(name string) (string, error) {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\:*?"<>|`) {
+		return "", fmt.Errorf("\"%s\" is not a valid server name", name)
+	}
+
+	dest := filepath.Join(C.Application.WorkingDir, name)
+	if _, err := os.Stat(dest); err == nil {
+		return "", fmt.Errorf("\"%s\" already exists", name)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+	return dest, nil
+}
+
+func loadTrash() ([]TrashEntry, error) {
+	f, err := os.Open(filepath.Join(TrashDir(), trashIndexName))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return []TrashEntry{}, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	entries := []TrashEntry{}
+	err = json.NewDecoder(f).Decode(&entries)
+	return entries, err
+}
+
+func saveTrash(entries []TrashEntry) error {
+	f, err := os.Create(filepath.Join(TrashDir(), trashIndexName))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	encoder := json.NewEncoder(f)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(entries)
+}
+
+// ListTrash returns the deleted servers, the most recent first
+func ListTrash() ([]TrashEntry, error) {
+	entries, err := loadTrash()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].DeletedAt.After(entries[j].DeletedAt) })
+	return entries, nil
+}
+
+func pruneTrash(entries []TrashEntry) []TrashEntry {
+	result := []TrashEntry{}
+	for _, e := range entries {
+		if time.Since(e.DeletedAt) < trashExpiry {
+			result = append(result, e)
+			continue
+		}
+
+		L.Info.Printf("Permanently deleting \"%s\" from the trash\n", e.Name)
+		if err := os.RemoveAll(filepath.Join(TrashDir(), e.ID)); err != nil {
+			L.Warn.Printf("Unable to delete %s: %v\n", e.ID, err)
+			result = append(result, e)
+		}
+	}
+	return result
+}
+
+// DeleteServer moves the server to the trash. Servers with unsynced changes
+// are only deleted if force is true since those changes would be lost.
+func DeleteServer(s *Server, force bool) error {
+	if err := s.checkCanBeChanged(); err != nil {
+		return err
+	}
+	if s.Unsynced && !force {
+		return fmt.Errorf("\"%s\" has changes that were never pushed, sync it first or force the deletion", s.Name)
+	}
+
+	if err := os.MkdirAll(TrashDir(), 0700); err != nil {
+		return err
+	}
+
+	entries, err := loadTrash()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	entry := TrashEntry{
+		ID:           s.Name + "@" + now.Format(snapshotTimeFormat),
+		Name:         s.Name,
+		OriginalPath: pushQueueKey(s.BaseDir),
+		DeletedAt:    now,
+	}
+
+	L.Info.Printf("Moving \"%s\" to the trash\n", s.Name)
+	if err = moveDir(s.BaseDir, filepath.Join(TrashDir(), entry.ID)); err != nil {
+		return err
+	}
+
+	if err = dequeuePush(entry.OriginalPath); err != nil {
+		L.Warn.Printf("Unable to update the push queue: %v\n", err)
+	}
+
+	entries = pruneTrash(append(entries, entry))
+	if err = saveTrash(entries); err != nil {
+		return err
+	}
+
+	L.Ok.Printf("\"%s\" was moved to the trash, it will be kept for %d days\n", s.Name, int(trashExpiry.Hours()/24))
+	return nil
+}
+
+// RestoreFromTrash moves a deleted server back to where it was
+func RestoreFromTrash(id string) error {
+	entries, err := loadTrash()
+	if err != nil {
+		return err
+	}
+
+	for i, e := range entries {
+		if e.ID != id {
+			continue
+		}
+
+		if _, err := os.Stat(e.OriginalPath); err == nil {
+			return fmt.Errorf("\"%s\" already exists, rename it and try again", e.OriginalPath)
+		}
+
+		L.Info.Printf("Restoring \"%s\" from the trash\n", e.Name)
+		if err = moveDir(filepath.Join(TrashDir(), e.ID), e.OriginalPath); err != nil {
+			return err
+		}
+
+		entries = append(entries[:i], entries[i+1:]...)
+		return saveTrash(entries)
+	}
+
+	return fmt.Errorf("%s was not found in the trash", id)
+}
+
+// RenameServer renames the server folder. Git remotes are left untouched.
+func RenameServer(s *Server, newName string) error {
+	if err := s.checkCanBeChanged(); err != nil {
+		return err
+	}
+
+	dest, err := validateServerName(newName)
+	if err != nil {
+		return err
+	}
+
+	oldPath := pushQueueKey(s.BaseDir)
+	oldSnapshotPrefix := snapshotArchivePrefix(s.BaseDir)
+
+	L.Info.Printf("Renaming \"%s\" to \"%s\"\n", s.Name, newName)
+	if err = os.Rename(s.BaseDir, dest); err != nil {
+		return err
+	}
+	s.Name = newName
+	s.BaseDir = dest
+
+	if s.Unsynced {
+		err = updatePushQueue(func(queue []pendingPush) []pendingPush {
+			for i := range queue {
+				if queue[i].BaseDir == oldPath {
+					queue[i].BaseDir = pushQueueKey(dest)
+				}
+			}
+			return queue
+		})
+		if err != nil {
+			L.Warn.Printf("Unable to update the push queue: %v\n", err)
+		}
+	}
+
+	// Keep the snapshots of the old name
+	snapshots, _ := filepath.Glob(filepath.Join(SnapshotsDir(), oldSnapshotPrefix+"*"))
+	for _, snap := range snapshots {
+		newSnap := filepath.Join(SnapshotsDir(), snapshotArchivePrefix(dest)+strings.TrimPrefix(filepath.Base(snap), oldSnapshotPrefix))
+		if err = os.Rename(snap, newSnap); err != nil {
+			L.Warn.Printf("Unable to rename snapshot %s: %v\n", snap, err)
+		}
+	}
+
+	L.Ok.Println("Server renamed")
+	return nil
+}
+
+// DuplicateServer copies the server to a new folder. The copy keeps the Git
+// history but not the remotes, otherwise both servers would push to the
+// same repository.
+func DuplicateServer(s *Server, newName string) error {
+	if err := s.checkCanBeChanged(); err != nil {
+		return err
+	}
+
+	dest, err := validateServerName(newName)
+	if err != nil {
+		return err
+	}
+
+	L.Info.Printf("Copying \"%s\" to \"%s\"\n", s.Name, newName)
+	if err = copyDir(s.BaseDir, dest); err != nil {
+		os.RemoveAll(dest)
+		return err
+	}
+
+	if s.HasGit && hasGit {
+		remotes, err := gitOutputLines(dest, "remote")
+		if err != nil {
+			return err
+		}
+		for _, r := range remotes {
+			if err = RunCmdPretty(dest, "git", "remote", "remove", r); err != nil {
+				return err
+			}
+		}
+
+		if len(remotes) > 0 {
+			L.Warn.Printf("\"%s\" has no remotes, add one to sync it\n", newName)
+		}
+	}
+
+	L.Ok.Println("Server duplicated")
+	return nil
+}
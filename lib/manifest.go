@@ -252,3 +252,28 @@ func GetVersionInfosSorted(progress ManifestDownloadProgress) ([]VersionInfo, er
 	sort.Sort(sort.Reverse(VerInfos(vers)))
 	return vers, nil
 }
+
+const (
+	LatestRelease  = "latest"
+	LatestSnapshot = "latest-snapshot"
+)
+
+// FindVersion returns the version with the given id. The special ids
+// "latest" and "latest-snapshot" are also accepted.
+func FindVersion(id string, progress ManifestDownloadProgress) (*VersionInfo, error) {
+	vers, err := GetVersionInfosSorted(progress)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, v := range vers {
+		switch {
+		case id == LatestSnapshot,
+			id == LatestRelease && v.Type == VersionTypeRelease,
+			id == v.ID:
+			return &v, nil
+		}
+	}
+
+	return nil, fmt.Errorf("Version %s was not found", id)
+}
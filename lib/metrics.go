@@ -0,0 +1,287 @@
+package lib
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metrics in the Prometheus text format, they only describe what happens in
+// this server-tool process
+
+type serverMetrics struct {
+	baseDir      string
+	running      bool
+	pid          int
+	sessionStart time.Time
+	// Duration of the last Git synchronization and number of failures, by
+	// operation
+	gitDuration map[string]time.Duration
+	gitFailures map[string]uint64
+}
+
+var metrics = struct {
+	sync.Mutex
+	servers map[string]*serverMetrics
+	// Downloaded bytes by kind of file
+	downloads map[string]uint64
+}{
+	servers:   map[string]*serverMetrics{},
+	downloads: map[string]uint64{},
+}
+
+func metricsFor(s *Server) *serverMetrics {
+	m, ok := metrics.servers[s.Name]
+	if !ok {
+		m = &serverMetrics{
+			baseDir:     s.BaseDir,
+			gitDuration: map[string]time.Duration{},
+			gitFailures: map[string]uint64{},
+		}
+		metrics.servers[s.Name] = m
+	}
+	return m
+}
+
+func metricsServerStarted(s *Server, pid int) {
+	metrics.Lock()
+	defer metrics.Unlock()
+
+	m := metricsFor(s)
+	m.running = true
+	m.pid = pid
+	m.sessionStart = time.Now()
+}
+
+func metricsServerStopped(s *Server) {
+	metrics.Lock()
+	defer metrics.Unlock()
+
+	m := metricsFor(s)
+	m.running = false
+	m.pid = 0
+}
+
+// metricsGitSync records a Git synchronization, operation is pre or post
+func metricsGitSync(s *Server, operation string, start time.Time, err error) {
+	metrics.Lock()
+	defer metrics.Unlock()
+
+	m := metricsFor(s)
+	m.gitDuration[operation] = time.Since(start)
+	if err != nil {
+		m.gitFailures[operation]++
+	}
+}
+
+func metricsDownloaded(kind string, n int64) {
+	metrics.Lock()
+	metrics.downloads[kind] += uint64(n)
+	metrics.Unlock()
+}
+
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+type metricsWriter struct {
+	w io.Writer
+}
+
+func (w *metricsWriter) header(name string, kind string, help string) {
+	fmt.Fprintf(w.w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// sample writes a sample, labels are pairs of names and values
+func (w *metricsWriter) sample(name string, value float64, labels ...string) {
+	pairs := []string{}
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, labels[i], escapeLabel(labels[i+1])))
+	}
+
+	if len(pairs) > 0 {
+		fmt.Fprintf(w.w, "%s{%s} %g\n", name, strings.Join(pairs, ","), value)
+	} else {
+		fmt.Fprintf(w.w, "%s %g\n", name, value)
+	}
+}
+
+type serverSnapshot struct {
+	name         string
+	baseDir      string
+	running      bool
+	pid          int
+	sessionStart time.Time
+	gitDuration  map[string]time.Duration
+	gitFailures  map[string]uint64
+}
+
+// Well below the default scrape timeout of Prometheus
+const metricsPingTimeout = 2 * time.Second
+
+// Operations recorded by metricsGitSync
+var gitSyncOperations = []string{"pre", "post"}
+
+// writeMetrics copies the state under the lock, the slow parts (pings and
+// /proc) are done without it
+func writeMetrics(out io.Writer) {
+	metrics.Lock()
+	servers := []serverSnapshot{}
+	for name, m := range metrics.servers {
+		snapshot := serverSnapshot{
+			name:         name,
+			baseDir:      m.baseDir,
+			running:      m.running,
+			pid:          m.pid,
+			sessionStart: m.sessionStart,
+			gitDuration:  map[string]time.Duration{},
+			gitFailures:  map[string]uint64{},
+		}
+		for k, v := range m.gitDuration {
+			snapshot.gitDuration[k] = v
+		}
+		for k, v := range m.gitFailures {
+			snapshot.gitFailures[k] = v
+		}
+		servers = append(servers, snapshot)
+	}
+	downloadKinds := []string{}
+	downloads := map[string]uint64{}
+	for k, v := range metrics.downloads {
+		downloadKinds = append(downloadKinds, k)
+		downloads[k] = v
+	}
+	metrics.Unlock()
+
+	sort.Slice(servers, func(i, j int) bool { return servers[i].name < servers[j].name })
+	sort.Strings(downloadKinds)
+
+	w := &metricsWriter{out}
+
+	w.header("server_tool_info", "gauge", "Version of server-tool")
+	w.sample("server_tool_info", 1, "version", Version)
+
+	w.header("server_tool_server_up", "gauge", "Whether the server is running")
+	for _, s := range servers {
+		up := 0.0
+		if s.running {
+			up = 1
+		}
+		w.sample("server_tool_server_up", up, "server", s.name)
+	}
+
+	w.header("server_tool_session_duration_seconds", "gauge", "Time since the server was started")
+	for _, s := range servers {
+		if s.running {
+			w.sample("server_tool_session_duration_seconds", time.Since(s.sessionStart).Seconds(), "server", s.name)
+		}
+	}
+
+	// A hung server does not answer, the scrape must not wait for it
+	players := make([]*ServerStatus, len(servers))
+	wg := sync.WaitGroup{}
+	for i, s := range servers {
+		if !s.running {
+			continue
+		}
+		host, port, enabled := serverAddress(s.baseDir)
+		if !enabled {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, host string, port uint16) {
+			defer wg.Done()
+			players[i], _ = pingServer(host, port, metricsPingTimeout)
+		}(i, host, port)
+	}
+	wg.Wait()
+
+	w.header("server_tool_players_online", "gauge", "Players connected to the server")
+	for i, s := range servers {
+		if players[i] != nil {
+			w.sample("server_tool_players_online", float64(players[i].Players.Online), "server", s.name)
+		}
+	}
+
+	type serverStats struct {
+		name  string
+		stats ProcessStats
+	}
+	stats := []serverStats{}
+	for _, s := range servers {
+		if s.running {
+			if st, err := readProcessStats(s.pid); err == nil {
+				stats = append(stats, serverStats{s.name, st})
+			}
+		}
+	}
+	w.header("server_tool_process_resident_memory_bytes", "gauge", "Resident memory of the server process")
+	for _, st := range stats {
+		w.sample("server_tool_process_resident_memory_bytes", float64(st.stats.Memory), "server", st.name)
+	}
+	w.header("server_tool_process_cpu_seconds_total", "counter", "CPU time used by the server process")
+	for _, st := range stats {
+		w.sample("server_tool_process_cpu_seconds_total", st.stats.CPUTime.Seconds(), "server", st.name)
+	}
+	w.header("server_tool_process_threads", "gauge", "Threads of the server process")
+	for _, st := range stats {
+		w.sample("server_tool_process_threads", float64(st.stats.Threads), "server", st.name)
+	}
+
+	w.header("server_tool_git_sync_duration_seconds", "gauge", "Duration of the last Git synchronization before (pre) or after (post) the server ran")
+	for _, s := range servers {
+		for _, op := range gitSyncOperations {
+			if d, ok := s.gitDuration[op]; ok {
+				w.sample("server_tool_git_sync_duration_seconds", d.Seconds(), "server", s.name, "operation", op)
+			}
+		}
+	}
+	w.header("server_tool_git_sync_failures_total", "counter", "Failed Git synchronizations")
+	for _, s := range servers {
+		for _, op := range gitSyncOperations {
+			w.sample("server_tool_git_sync_failures_total", float64(s.gitFailures[op]), "server", s.name, "operation", op)
+		}
+	}
+
+	w.header("server_tool_download_bytes_total", "counter", "Bytes downloaded, by kind of file")
+	for _, kind := range downloadKinds {
+		w.sample("server_tool_download_bytes_total", float64(downloads[kind]), "kind", kind)
+	}
+
+	if info, err := os.Stat(ManifestPath()); err == nil {
+		w.header("server_tool_manifest_cache_age_seconds", "gauge", "Age of the cached Minecraft version manifest")
+		w.sample("server_tool_manifest_cache_age_seconds", time.Since(info.ModTime()).Seconds())
+	}
+}
+
+// StartMetricsServer serves the metrics on C.Metrics.Listen in the background
+func StartMetricsServer() error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		writeMetrics(w)
+	})
+
+	server := &http.Server{
+		Addr:              C.Metrics.Listen,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	errs := make(chan error, 1)
+	go func() { errs <- server.ListenAndServe() }()
+
+	// Report the errors that happen immediately, like the port being in use
+	select {
+	case err := <-errs:
+		return fmt.Errorf("Unable to serve the metrics: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	L.Info.Printf("Serving metrics at http://%s/metrics\n", C.Metrics.Listen)
+	return nil
+}
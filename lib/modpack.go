@@ -0,0 +1,253 @@
+package lib
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ModpackProgress is notified while the files of a modpack are downloaded
+type ModpackProgress interface {
+	SetTotal(int)
+	Add(string)
+	Done()
+}
+
+const (
+	mrpackExtension       = ".mrpack"
+	mrpackIndexFileName   = "modrinth.index.json"
+	mrpackOverrides       = "overrides/"
+	mrpackServerOverrides = "server-overrides/"
+)
+
+type mrpackFile struct {
+	Path   string            `json:"path"`
+	Hashes map[string]string `json:"hashes"`
+	Env    struct {
+		Server string `json:"server"`
+	} `json:"env"`
+	Downloads []string `json:"downloads"`
+}
+
+type mrpackIndex struct {
+	FormatVersion int               `json:"formatVersion"`
+	Game          string            `json:"game"`
+	Name          string            `json:"name"`
+	VersionID     string            `json:"versionId"`
+	Files         []mrpackFile      `json:"files"`
+	Dependencies  map[string]string `json:"dependencies"`
+}
+
+// IsModpack reports whether ImportModpack can import the file
+func IsModpack(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), mrpackExtension) || isCurseforgeModpack(path)
+}
+
+// extractZipPrefix extracts the files of the zip under prefix to dest,
+// removing the prefix from their path
+func extractZipPrefix(r *zip.Reader, prefix string, dest string) error {
+	for _, f := range r.File {
+		if !strings.HasPrefix(f.Name, prefix) || f.FileInfo().IsDir() {
+			continue
+		}
+
+		name := strings.TrimPrefix(f.Name, prefix)
+		if err := checkIllegalPath(dest, name); err != nil {
+			return err
+		}
+		path := filepath.Join(dest, name)
+
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+
+		b, err := readZipFile(f)
+		if err != nil {
+			return err
+		}
+		if err = os.WriteFile(path, b, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *mrpackFile) checksum() checksum {
+	if sum, ok := f.Hashes["sha512"]; ok {
+		return sha512Checksum(sum)
+	}
+	if sum, ok := f.Hashes["sha1"]; ok {
+		return sha1Checksum(sum)
+	}
+	return noChecksum
+}
+
+// downloadModpackFiles downloads the files to dest, trying every mirror
+func downloadModpackFiles(files []mrpackFile, dest string, progress ModpackProgress) error {
+	progress.SetTotal(len(files))
+	defer progress.Done()
+
+	for _, f := range files {
+		if err := checkIllegalPath(dest, f.Path); err != nil {
+			return err
+		}
+		if f.checksum().sum == "" {
+			return fmt.Errorf("%s has no hash", f.Path)
+		}
+
+		path := filepath.Join(dest, f.Path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+
+		err := fmt.Errorf("%s has no downloads", f.Path)
+		for _, url := range f.Downloads {
+			if err = downloadFile(url, path, f.checksum(), silentDownload{}); err == nil {
+				break
+			}
+			L.Warn.Printf("Unable to download %s from %s: %v\n", f.Path, url, err)
+		}
+		if err != nil {
+			return err
+		}
+		progress.Add(f.Path)
+	}
+	return nil
+}
+
+func readMrpackIndex(r *zip.Reader) (*mrpackIndex, error) {
+	for _, f := range r.File {
+		if f.Name != mrpackIndexFileName {
+			continue
+		}
+
+		b, err := readZipFile(f)
+		if err != nil {
+			return nil, err
+		}
+
+		index := &mrpackIndex{}
+		if err = json.Unmarshal(b, index); err != nil {
+			return nil, fmt.Errorf("Invalid %s: %v", mrpackIndexFileName, err)
+		}
+		if index.Game != "minecraft" {
+			return nil, fmt.Errorf("The modpack is for %s, not Minecraft", index.Game)
+		}
+		return index, nil
+	}
+	return nil, fmt.Errorf("%s is missing", mrpackIndexFileName)
+}
+
+// modpackServer creates the server for a modpack that requires the given
+// Minecraft version and loader
+func modpackServer(name string, mcVersion string, loader string, loaderVersion string, manifestProgress ManifestDownloadProgress, download DownloadProgress) (*Server, error) {
+	opts := CreateOptions{Type: Vanilla}
+	switch loader {
+	case "":
+	case "fabric":
+		opts.Type = Fabric
+		opts.FabricLoader = loaderVersion
+	default:
+		return nil, fmt.Errorf("The modpack uses %s which is not supported, only Fabric and vanilla modpacks can be imported", loader)
+	}
+
+	if mcVersion == "" {
+		return nil, errors.New("The modpack does not say which Minecraft version it needs")
+	}
+	version, err := FindVersion(mcVersion, manifestProgress)
+	if err != nil {
+		return nil, err
+	}
+
+	baseDir, err := validateServerName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		Name:    name,
+		BaseDir: baseDir,
+		Version: version,
+		Type:    opts.Type,
+	}
+	if err = CreateServer(s, opts, download); err != nil {
+		os.RemoveAll(baseDir)
+		return nil, err
+	}
+	return s, nil
+}
+
+func importMrpack(path string, name string, progress ModpackProgress, manifestProgress ManifestDownloadProgress, download DownloadProgress) (err error) {
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	index, err := readMrpackIndex(&r.Reader)
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		name = index.Name
+	}
+
+	loader, loaderVersion := "", ""
+	for dep, version := range index.Dependencies {
+		switch dep {
+		case "minecraft":
+		case "fabric-loader":
+			loader, loaderVersion = "fabric", version
+		default:
+			loader = dep
+		}
+	}
+
+	L.Info.Printf("Importing %s %s\n", index.Name, index.VersionID)
+	s, err := modpackServer(name, index.Dependencies["minecraft"], loader, loaderVersion, manifestProgress, download)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			os.RemoveAll(s.BaseDir)
+		}
+	}()
+
+	files := []mrpackFile{}
+	for _, f := range index.Files {
+		if f.Env.Server != "unsupported" {
+			files = append(files, f)
+		}
+	}
+	if err = downloadModpackFiles(files, s.BaseDir, progress); err != nil {
+		return err
+	}
+
+	// The server overrides are applied last so that they win
+	for _, prefix := range []string{mrpackOverrides, mrpackServerOverrides} {
+		if err = extractZipPrefix(&r.Reader, prefix, s.BaseDir); err != nil {
+			return err
+		}
+	}
+
+	L.Ok.Printf("%s imported as \"%s\"\n", index.Name, s.Name)
+	return nil
+}
+
+// ImportModpack creates a new server from a Modrinth or a CurseForge modpack.
+// If name is empty the name of the modpack is used.
+// The files that have to be downloaded by the user are returned.
+func ImportModpack(path string, name string, progress ModpackProgress, manifestProgress ManifestDownloadProgress, download DownloadProgress) ([]ManualDownload, error) {
+	if strings.EqualFold(filepath.Ext(path), mrpackExtension) {
+		return nil, importMrpack(path, name, progress, manifestProgress, download)
+	}
+	if isCurseforgeModpack(path) {
+		return importCurseforge(path, name, progress, manifestProgress, download)
+	}
+	return nil, fmt.Errorf("%s is not a supported modpack", filepath.Base(path))
+}
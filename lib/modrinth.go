@@ -0,0 +1,134 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+type modrinthFile struct {
+	URL      string            `json:"url"`
+	Filename string            `json:"filename"`
+	Primary  bool              `json:"primary"`
+	Size     uint64            `json:"size"`
+	Hashes   map[string]string `json:"hashes"`
+}
+
+type modrinthDependency struct {
+	VersionID      string `json:"version_id"`
+	ProjectID      string `json:"project_id"`
+	DependencyType string `json:"dependency_type"`
+}
+
+type modrinthVersion struct {
+	ID            string               `json:"id"`
+	ProjectID     string               `json:"project_id"`
+	Name          string               `json:"name"`
+	VersionNumber string               `json:"version_number"`
+	GameVersions  []string             `json:"game_versions"`
+	Loaders       []string             `json:"loaders"`
+	Files         []modrinthFile       `json:"files"`
+	Dependencies  []modrinthDependency `json:"dependencies"`
+}
+
+type modrinthProject struct {
+	ID    string `json:"id"`
+	Slug  string `json:"slug"`
+	Title string `json:"title"`
+}
+
+func modrinthGet(path string, query url.Values, out any) error {
+	u := strings.TrimRight(C.Modrinth.URL, "/") + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	L.Debug.Printf("GET %s\n", u)
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	// Modrinth asks to identify the application
+	req.Header.Set("User-Agent", fmt.Sprintf("billy4479/server-tool/%s", Version))
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%s was not found on Modrinth", path)
+	}
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("Modrinth request %s failed: %s", path, res.Status)
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+func jsonList(values ...string) string {
+	b, _ := json.Marshal(values)
+	return string(b)
+}
+
+func modrinthGetProject(idOrSlug string) (*modrinthProject, error) {
+	project := &modrinthProject{}
+	err := modrinthGet("/project/"+url.PathEscape(idOrSlug), nil, project)
+	return project, err
+}
+
+func modrinthGetVersion(id string) (*modrinthVersion, error) {
+	version := &modrinthVersion{}
+	err := modrinthGet("/version/"+url.PathEscape(id), nil, version)
+	return version, err
+}
+
+// modrinthProjectVersions returns the versions of the project compatible with
+// one of the loaders and the Minecraft version, the newest first
+func modrinthProjectVersions(idOrSlug string, loaders []string, gameVersion string) ([]modrinthVersion, error) {
+	query := url.Values{}
+	query.Set("loaders", jsonList(loaders...))
+	query.Set("game_versions", jsonList(gameVersion))
+
+	versions := []modrinthVersion{}
+	err := modrinthGet("/project/"+url.PathEscape(idOrSlug)+"/version", query, &versions)
+	return versions, err
+}
+
+// latestModrinthVersion returns the newest version of the project compatible
+// with one of the loaders and the Minecraft version
+func latestModrinthVersion(idOrSlug string, loaders []string, gameVersion string) (*modrinthVersion, error) {
+	versions, err := modrinthProjectVersions(idOrSlug, loaders, gameVersion)
+	if err != nil {
+		return nil, err
+	}
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("%s has no %s version for Minecraft %s", idOrSlug, strings.Join(loaders, "/"), gameVersion)
+	}
+	return &versions[0], nil
+}
+
+// primaryFile returns the file to download for the version
+func (v *modrinthVersion) primaryFile() (*modrinthFile, error) {
+	if len(v.Files) == 0 {
+		return nil, fmt.Errorf("Version %s has no files", v.VersionNumber)
+	}
+	for i := range v.Files {
+		if v.Files[i].Primary {
+			return &v.Files[i], nil
+		}
+	}
+	return &v.Files[0], nil
+}
+
+func (f *modrinthFile) checksum() checksum {
+	if sum, ok := f.Hashes["sha512"]; ok {
+		return sha512Checksum(sum)
+	}
+	if sum, ok := f.Hashes["sha1"]; ok {
+		return sha1Checksum(sum)
+	}
+	return noChecksum
+}
@@ -0,0 +1,420 @@
+package lib
+
+import (
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	ModsLockFileName = "mods.lock"
+	modsDirName      = "mods"
+	// List of the jars installed by server-tool, the others are never touched
+	managedModsFileName = ".server-tool-mods.json"
+	modrinthFabric      = "fabric"
+)
+
+var ErrNotFabric = errors.New("Mods can only be installed on Fabric servers")
+
+// LockedMod is a mod jar pinned in mods.lock
+type LockedMod struct {
+	ProjectID     string
+	Slug          string
+	VersionID     string
+	VersionNumber string
+	Filename      string
+	URL           string
+	SHA512        string
+	// Explicit is false for the mods installed only as dependencies
+	Explicit bool
+	// Projects that require this mod
+	RequiredBy []string `json:",omitempty"`
+}
+
+// ModsLock is stored in the server folder so that every host downloads the
+// same jars
+type ModsLock struct {
+	MinecraftVersion string
+	Loader           string
+	Mods             []LockedMod
+}
+
+func (l *ModsLock) find(idOrSlug string) *LockedMod {
+	for i := range l.Mods {
+		if l.Mods[i].ProjectID == idOrSlug || l.Mods[i].Slug == idOrSlug {
+			return &l.Mods[i]
+		}
+	}
+	return nil
+}
+
+// explicit returns the mods that were not installed as dependencies
+func (l *ModsLock) explicit() []LockedMod {
+	mods := []LockedMod{}
+	for _, m := range l.Mods {
+		if m.Explicit {
+			mods = append(mods, m)
+		}
+	}
+	return mods
+}
+
+func LoadModsLock(baseDir string) (*ModsLock, error) {
+	b, err := os.ReadFile(filepath.Join(baseDir, ModsLockFileName))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	lock := &ModsLock{}
+	if err = json.Unmarshal(b, lock); err != nil {
+		return nil, fmt.Errorf("Invalid %s: %v", ModsLockFileName, err)
+	}
+	return lock, nil
+}
+
+func saveModsLock(baseDir string, lock *ModsLock) error {
+	sort.Slice(lock.Mods, func(i, j int) bool { return lock.Mods[i].Slug < lock.Mods[j].Slug })
+
+	b, err := json.MarshalIndent(lock, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(baseDir, ModsLockFileName), append(b, '\n'), 0644)
+}
+
+// modResolver builds a lock, reusing the versions of the old lock for the
+// projects that are not being updated
+type modResolver struct {
+	s      *Server
+	old    *ModsLock
+	new    *ModsLock
+	update func(m *LockedMod) bool
+}
+
+func (r *modResolver) resolve(idOrSlug string, requiredBy string) error {
+	if m := r.new.find(idOrSlug); m != nil {
+		if requiredBy != "" {
+			m.RequiredBy = append(m.RequiredBy, requiredBy)
+		} else {
+			m.Explicit = true
+		}
+		return nil
+	}
+
+	var version *modrinthVersion
+	var err error
+	if old := r.old.find(idOrSlug); old != nil && !r.update(old) {
+		version, err = modrinthGetVersion(old.VersionID)
+	} else {
+		version, err = latestModrinthVersion(idOrSlug, []string{modrinthFabric}, r.s.Version.ID)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Dependencies are referenced by id, it could be already in the lock
+	if r.new.find(version.ProjectID) != nil {
+		return r.resolve(version.ProjectID, requiredBy)
+	}
+
+	project, err := modrinthGetProject(version.ProjectID)
+	if err != nil {
+		return err
+	}
+
+	file, err := version.primaryFile()
+	if err != nil {
+		return err
+	}
+	if file.Hashes["sha512"] == "" {
+		return fmt.Errorf("Modrinth did not provide a hash for %s", file.Filename)
+	}
+	if err = checkIllegalPath(r.s.BaseDir, filepath.Join(modsDirName, file.Filename)); err != nil {
+		return err
+	}
+
+	mod := LockedMod{
+		ProjectID:     version.ProjectID,
+		Slug:          project.Slug,
+		VersionID:     version.ID,
+		VersionNumber: version.VersionNumber,
+		Filename:      file.Filename,
+		URL:           file.URL,
+		SHA512:        file.Hashes["sha512"],
+		Explicit:      requiredBy == "",
+	}
+	if requiredBy != "" {
+		mod.RequiredBy = []string{requiredBy}
+	}
+	r.new.Mods = append(r.new.Mods, mod)
+	L.Debug.Printf("Resolved %s %s\n", mod.Slug, mod.VersionNumber)
+
+	for _, dep := range version.Dependencies {
+		if dep.DependencyType != "required" {
+			continue
+		}
+
+		id := dep.ProjectID
+		if id == "" {
+			// Only the version is known
+			v, err := modrinthGetVersion(dep.VersionID)
+			if err != nil {
+				return err
+			}
+			id = v.ProjectID
+		}
+		if err = r.resolve(id, mod.Slug); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rebuildModsLock resolves the explicit mods and their dependencies again.
+// The mods for which update returns true are moved to their latest version.
+func rebuildModsLock(s *Server, old *ModsLock, explicit []string, update func(m *LockedMod) bool) (*ModsLock, error) {
+	r := &modResolver{
+		s:   s,
+		old: old,
+		new: &ModsLock{
+			MinecraftVersion: s.Version.ID,
+			Loader:           modrinthFabric,
+			Mods:             []LockedMod{},
+		},
+		update: update,
+	}
+
+	for _, id := range explicit {
+		if err := r.resolve(id, ""); err != nil {
+			return nil, err
+		}
+	}
+	return r.new, nil
+}
+
+func loadModsLockForChange(s *Server) (*ModsLock, error) {
+	if s.Type != Fabric {
+		return nil, ErrNotFabric
+	}
+	if s.IsRunning() {
+		return nil, ErrServerRunning
+	}
+
+	lock, err := LoadModsLock(s.BaseDir)
+	if err != nil {
+		return nil, err
+	}
+	if lock == nil {
+		lock = &ModsLock{}
+	}
+	return lock, nil
+}
+
+func explicitIDs(lock *ModsLock) []string {
+	ids := []string{}
+	for _, m := range lock.explicit() {
+		ids = append(ids, m.ProjectID)
+	}
+	return ids
+}
+
+func applyModsLock(s *Server, lock *ModsLock, progress DownloadProgress) error {
+	if err := saveModsLock(s.BaseDir, lock); err != nil {
+		return err
+	}
+	return SyncMods(s, progress)
+}
+
+// AddMod installs the latest version of a Modrinth project compatible with
+// the server, along with its required dependencies
+func AddMod(s *Server, project string, progress DownloadProgress) error {
+	lock, err := loadModsLockForChange(s)
+	if err != nil {
+		return err
+	}
+	if m := lock.find(project); m != nil && m.Explicit {
+		return fmt.Errorf("%s is already installed", project)
+	}
+
+	keep := func(m *LockedMod) bool { return false }
+	newLock, err := rebuildModsLock(s, lock, append(explicitIDs(lock), project), keep)
+	if err != nil {
+		return err
+	}
+	return applyModsLock(s, newLock, progress)
+}
+
+// RemoveMod uninstalls a mod and the dependencies that are no longer needed
+func RemoveMod(s *Server, project string, progress DownloadProgress) error {
+	lock, err := loadModsLockForChange(s)
+	if err != nil {
+		return err
+	}
+
+	m := lock.find(project)
+	if m == nil {
+		return fmt.Errorf("%s is not installed", project)
+	}
+	if !m.Explicit {
+		return fmt.Errorf("%s is a dependency of %s, remove them instead", m.Slug, strings.Join(m.RequiredBy, ", "))
+	}
+	if len(m.RequiredBy) != 0 {
+		L.Warn.Printf("%s is kept since it is required by %s\n", m.Slug, strings.Join(m.RequiredBy, ", "))
+	}
+
+	ids := []string{}
+	for _, id := range explicitIDs(lock) {
+		if id != m.ProjectID {
+			ids = append(ids, id)
+		}
+	}
+
+	keep := func(m *LockedMod) bool { return false }
+	newLock, err := rebuildModsLock(s, lock, ids, keep)
+	if err != nil {
+		return err
+	}
+	return applyModsLock(s, newLock, progress)
+}
+
+// UpdateMods moves the given mods, or all of them if none is given, to
+// their latest version compatible with the server
+func UpdateMods(s *Server, projects []string, progress DownloadProgress) error {
+	lock, err := loadModsLockForChange(s)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range projects {
+		if lock.find(p) == nil {
+			return fmt.Errorf("%s is not installed", p)
+		}
+	}
+
+	update := func(m *LockedMod) bool {
+		if len(projects) == 0 {
+			return true
+		}
+		for _, p := range projects {
+			if p == m.ProjectID || p == m.Slug {
+				return true
+			}
+		}
+		return false
+	}
+
+	newLock, err := rebuildModsLock(s, lock, explicitIDs(lock), update)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range newLock.Mods {
+		if old := lock.find(m.ProjectID); old != nil && old.VersionID != m.VersionID {
+			L.Info.Printf("%s: %s -> %s\n", m.Slug, old.VersionNumber, m.VersionNumber)
+		}
+	}
+	return applyModsLock(s, newLock, progress)
+}
+
+func hashFileSHA512(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha512.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func loadManagedMods(modsDir string) []string {
+	managed := []string{}
+	b, err := os.ReadFile(filepath.Join(modsDir, managedModsFileName))
+	if err == nil {
+		_ = json.Unmarshal(b, &managed)
+	}
+	return managed
+}
+
+// checkModFilename rejects the names that point outside of the mods folder
+func checkModFilename(name string) error {
+	if name == "" || name == "." || name == ".." || filepath.Base(name) != name || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("Invalid mod file name %q", name)
+	}
+	return nil
+}
+
+// SyncMods makes the mods folder match mods.lock: missing or modified jars
+// are downloaded and the jars installed by server-tool that are no longer in
+// the lock are removed. Jars added by hand are left alone.
+func SyncMods(s *Server, progress DownloadProgress) error {
+	lock, err := LoadModsLock(s.BaseDir)
+	if err != nil || lock == nil {
+		return err
+	}
+
+	if lock.MinecraftVersion != s.Version.ID {
+		L.Warn.Printf("%s was made for Minecraft %s, update the mods\n", ModsLockFileName, lock.MinecraftVersion)
+	}
+
+	modsDir := filepath.Join(s.BaseDir, modsDirName)
+	if err = os.MkdirAll(modsDir, 0755); err != nil {
+		return err
+	}
+
+	inLock := map[string]bool{}
+	for _, m := range lock.Mods {
+		// The lock comes from other hosts through Git
+		if err = checkModFilename(m.Filename); err != nil {
+			return err
+		}
+		inLock[m.Filename] = true
+		path := filepath.Join(modsDir, m.Filename)
+
+		if sum, err := hashFileSHA512(path); err == nil && sum == m.SHA512 {
+			continue
+		}
+
+		L.Info.Printf("Downloading %s %s\n", m.Slug, m.VersionNumber)
+		if err = downloadFile(m.URL, path, sha512Checksum(m.SHA512), progress); err != nil {
+			return err
+		}
+	}
+
+	for _, name := range loadManagedMods(modsDir) {
+		if inLock[name] {
+			continue
+		}
+		if err = checkModFilename(name); err != nil {
+			L.Warn.Println(err)
+			continue
+		}
+		L.Info.Printf("Removing %s\n", name)
+		if err = os.Remove(filepath.Join(modsDir, name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	managed := []string{}
+	for _, m := range lock.Mods {
+		managed = append(managed, m.Filename)
+	}
+	b, err := json.Marshal(managed)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(modsDir, managedModsFileName), b, 0644)
+}
@@ -0,0 +1,167 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	motdProperty = "motd"
+	// Character that starts a formatting code
+	FormattingCode = '§'
+	// Lines longer than this are cut in the server list
+	motdLineWidth = 59
+	motdMaxLines  = 2
+	ansiReset     = "\x1b[0m"
+)
+
+// Colors of the formatting codes, as ANSI 24-bit sequences
+var motdColors = map[rune]string{
+	'0': "\x1b[38;2;0;0;0m",
+	'1': "\x1b[38;2;0;0;170m",
+	'2': "\x1b[38;2;0;170;0m",
+	'3': "\x1b[38;2;0;170;170m",
+	'4': "\x1b[38;2;170;0;0m",
+	'5': "\x1b[38;2;170;0;170m",
+	'6': "\x1b[38;2;255;170;0m",
+	'7': "\x1b[38;2;170;170;170m",
+	'8': "\x1b[38;2;85;85;85m",
+	'9': "\x1b[38;2;85;85;255m",
+	'a': "\x1b[38;2;85;255;85m",
+	'b': "\x1b[38;2;85;255;255m",
+	'c': "\x1b[38;2;255;85;85m",
+	'd': "\x1b[38;2;255;85;255m",
+	'e': "\x1b[38;2;255;255;85m",
+	'f': "\x1b[38;2;255;255;255m",
+}
+
+var motdStyles = map[rune]string{
+	// Obfuscated text keeps changing, blinking is the closest thing
+	'k': "\x1b[5m",
+	'l': "\x1b[1m",
+	'm': "\x1b[9m",
+	'n': "\x1b[4m",
+	'o': "\x1b[3m",
+}
+
+func isFormattingCode(r rune) bool {
+	r = toLowerASCII(r)
+	_, isColor := motdColors[r]
+	_, isStyle := motdStyles[r]
+	return isColor || isStyle || r == 'r'
+}
+
+func toLowerASCII(r rune) rune {
+	if r >= 'A' && r <= 'Z' {
+		return r + 'a' - 'A'
+	}
+	return r
+}
+
+// ParseMOTDInput converts text typed by the user to a MOTD:
+// & can be used instead of § before a formatting code and \n starts the
+// second line
+func ParseMOTDInput(text string) string {
+	text = strings.ReplaceAll(text, `\n`, "\n")
+
+	runes := []rune(text)
+	for i := 0; i < len(runes)-1; i++ {
+		if runes[i] == '&' && isFormattingCode(runes[i+1]) {
+			runes[i] = FormattingCode
+		}
+	}
+	return string(runes)
+}
+
+// MOTDToInput is the inverse of ParseMOTDInput, it makes the MOTD easy to
+// edit on a single line
+func MOTDToInput(motd string) string {
+	motd = strings.ReplaceAll(motd, "\n", `\n`)
+	return strings.ReplaceAll(motd, string(FormattingCode), "&")
+}
+
+// StripFormatting removes the formatting codes from the MOTD
+func StripFormatting(motd string) string {
+	b := strings.Builder{}
+	runes := []rune(motd)
+	for i := 0; i < len(runes); i++ {
+		if runes[i] == FormattingCode && i+1 < len(runes) {
+			i++
+			continue
+		}
+		b.WriteRune(runes[i])
+	}
+	return b.String()
+}
+
+// FormatMOTDANSI renders the MOTD for a terminal
+func FormatMOTDANSI(motd string) string {
+	b := strings.Builder{}
+	runes := []rune(motd)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		if r == '\n' {
+			// Formatting does not carry over to the second line
+			b.WriteString(ansiReset + "\n")
+			continue
+		}
+		if r != FormattingCode || i+1 >= len(runes) {
+			b.WriteRune(r)
+			continue
+		}
+
+		i++
+		code := toLowerASCII(runes[i])
+		if color, ok := motdColors[code]; ok {
+			// Colors reset the styles
+			b.WriteString(ansiReset + color)
+		} else if style, ok := motdStyles[code]; ok {
+			b.WriteString(style)
+		} else if code == 'r' {
+			b.WriteString(ansiReset)
+		}
+	}
+	b.WriteString(ansiReset)
+	return b.String()
+}
+
+// GetMOTD returns the MOTD in server.properties
+func GetMOTD(s *Server) (string, error) {
+	props, err := LoadProperties(filepath.Join(s.BaseDir, PropertiesFileName))
+	if err != nil {
+		return "", err
+	}
+	return props.GetOr(motdProperty, ""), nil
+}
+
+// SetMOTD writes the MOTD to server.properties
+func SetMOTD(s *Server, motd string) error {
+	lines := strings.Split(motd, "\n")
+	if len(lines) > motdMaxLines {
+		return fmt.Errorf("The MOTD can have at most %d lines", motdMaxLines)
+	}
+	for i, line := range lines {
+		if n := utf8.RuneCountInString(StripFormatting(line)); n > motdLineWidth {
+			L.Warn.Printf("Line %d of the MOTD is %d characters long, it may be cut\n", i+1, n)
+		}
+	}
+	if strings.HasSuffix(motd, string(FormattingCode)) {
+		return errors.New("The MOTD ends with an incomplete formatting code")
+	}
+
+	path := filepath.Join(s.BaseDir, PropertiesFileName)
+	props, err := LoadProperties(path)
+	if err != nil {
+		return err
+	}
+	props.Set(motdProperty, motd)
+	if err = props.Save(path); err != nil {
+		return err
+	}
+
+	L.Ok.Printf("MOTD of \"%s\" changed\n", s.Name)
+	return nil
+}
@@ -0,0 +1,552 @@
+package lib
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	pluginsDirName = "plugins"
+	// List of the jars installed by server-tool and where they come from
+	managedPluginsFileName = ".server-tool-plugins.json"
+
+	PluginSourceHangar   = "hangar"
+	PluginSourceModrinth = "modrinth"
+)
+
+var (
+	ErrNotPaper = errors.New("Plugins can only be installed on Paper servers")
+
+	// Modrinth loaders whose plugins run on Paper
+	modrinthPluginLoaders = []string{"paper", "bukkit", "spigot"}
+)
+
+// A Plugin is a jar in the plugins folder of the server
+type Plugin struct {
+	Name        string
+	Version     string
+	Description string
+	// Oldest Minecraft version whose API the plugin uses, empty for legacy
+	// plugins
+	APIVersion string
+	Filename   string
+
+	// Where the plugin was downloaded from, empty if it was added by hand
+	Source  string
+	Project string
+}
+
+type managedPlugin struct {
+	Filename string
+	Source   string
+	Project  string
+	Version  string
+}
+
+// remotePlugin is a version of a plugin that can be downloaded
+type remotePlugin struct {
+	Version  string
+	Filename string
+	URL      string
+	checksum checksum
+}
+
+func (s *Server) PluginsDir() string {
+	return filepath.Join(s.BaseDir, pluginsDirName)
+}
+
+// readPluginJar reads the plugin.yml, or the paper-plugin.yml, of a jar
+func readPluginJar(path string) (*Plugin, error) {
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a plugin: %v", filepath.Base(path), err)
+	}
+	defer r.Close()
+
+	var f *zip.File
+	for _, zf := range r.File {
+		if zf.Name == "plugin.yml" || (zf.Name == "paper-plugin.yml" && f == nil) {
+			f = zf
+		}
+	}
+	if f == nil {
+		return nil, fmt.Errorf("%s is not a plugin: plugin.yml is missing", filepath.Base(path))
+	}
+
+	b, err := readZipFile(f)
+	if err != nil {
+		return nil, err
+	}
+
+	// Versions are often written as numbers, the nodes keep them as written
+	var meta struct {
+		Name        string    `yaml:"name"`
+		Version     yaml.Node `yaml:"version"`
+		Description string    `yaml:"description"`
+		APIVersion  yaml.Node `yaml:"api-version"`
+	}
+	if err = yaml.Unmarshal(b, &meta); err != nil {
+		return nil, fmt.Errorf("Invalid %s in %s: %v", f.Name, filepath.Base(path), err)
+	}
+	if meta.Name == "" {
+		return nil, fmt.Errorf("%s does not contain the name of the plugin", filepath.Base(path))
+	}
+
+	return &Plugin{
+		Name:        meta.Name,
+		Version:     meta.Version.Value,
+		Description: meta.Description,
+		APIVersion:  meta.APIVersion.Value,
+		Filename:    filepath.Base(path),
+	}, nil
+}
+
+// parseReleaseVersion splits a version like 1.20.4, ok is false for
+// snapshots and unknown versions
+func parseReleaseVersion(version string) ([]int, bool) {
+	parts := strings.Split(version, ".")
+	numbers := make([]int, len(parts))
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return nil, false
+		}
+		numbers[i] = n
+	}
+	return numbers, true
+}
+
+// Supports reports whether the plugin can run on the given Minecraft version.
+// Plugins without an API version, or with one that cannot be compared, are
+// assumed to work.
+func (p *Plugin) Supports(version string) bool {
+	api, ok := parseReleaseVersion(p.APIVersion)
+	if !ok {
+		return true
+	}
+	server, ok := parseReleaseVersion(version)
+	if !ok {
+		return true
+	}
+
+	for i := 0; i < len(api) || i < len(server); i++ {
+		a, s := 0, 0
+		if i < len(api) {
+			a = api[i]
+		}
+		if i < len(server) {
+			s = server[i]
+		}
+		if a != s {
+			return a < s
+		}
+	}
+	return true
+}
+
+func warnIncompatiblePlugin(s *Server, p *Plugin) {
+	if !p.Supports(s.Version.ID) {
+		L.Warn.Printf("%s uses the API of Minecraft %s but \"%s\" runs Minecraft %s, it may not work\n", p.Name, p.APIVersion, s.Name, s.Version.ID)
+	}
+}
+
+func loadManagedPlugins(dir string) []managedPlugin {
+	managed := []managedPlugin{}
+	b, err := os.ReadFile(filepath.Join(dir, managedPluginsFileName))
+	if err == nil {
+		_ = json.Unmarshal(b, &managed)
+	}
+	return managed
+}
+
+func saveManagedPlugins(dir string, managed []managedPlugin) error {
+	sort.Slice(managed, func(i, j int) bool { return managed[i].Filename < managed[j].Filename })
+
+	b, err := json.MarshalIndent(managed, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, managedPluginsFileName), append(b, '\n'), 0644)
+}
+
+// ListPlugins returns the plugins installed on the server
+func ListPlugins(s *Server) ([]Plugin, error) {
+	dir := s.PluginsDir()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return []Plugin{}, nil
+		}
+		return nil, err
+	}
+
+	managed := map[string]managedPlugin{}
+	for _, m := range loadManagedPlugins(dir) {
+		managed[m.Filename] = m
+	}
+
+	plugins := []Plugin{}
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".jar" {
+			continue
+		}
+
+		p, err := readPluginJar(filepath.Join(dir, e.Name()))
+		if err != nil {
+			L.Warn.Println(err)
+			continue
+		}
+		if m, ok := managed[p.Filename]; ok {
+			p.Source = m.Source
+			p.Project = m.Project
+		}
+		plugins = append(plugins, *p)
+	}
+	return plugins, nil
+}
+
+// findPlugin looks for a plugin by name, project or file name
+func findPlugin(plugins []Plugin, name string) *Plugin {
+	for i := range plugins {
+		p := &plugins[i]
+		if strings.EqualFold(p.Name, name) || p.Filename == name || (p.Project != "" && p.Project == name) {
+			return p
+		}
+	}
+	return nil
+}
+
+func checkCanChangePlugins(s *Server) error {
+	if s.Type != Paper {
+		return ErrNotPaper
+	}
+	if s.IsRunning() {
+		return ErrServerRunning
+	}
+	return nil
+}
+
+// installPluginJar copies the jar to the plugins folder and, if it was
+// downloaded, records where it comes from
+func installPluginJar(s *Server, path string, source string, project string) error {
+	p, err := readPluginJar(path)
+	if err != nil {
+		return err
+	}
+	warnIncompatiblePlugin(s, p)
+
+	installed, err := ListPlugins(s)
+	if err != nil {
+		return err
+	}
+	if other := findPlugin(installed, p.Name); other != nil {
+		return fmt.Errorf("%s is already installed as %s", p.Name, other.Filename)
+	}
+
+	dir := s.PluginsDir()
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	dest := filepath.Join(dir, filepath.Base(path))
+	if _, err = os.Stat(dest); err == nil {
+		return fmt.Errorf("%s already exists", dest)
+	}
+	if err = copyFile(path, dest, 0644); err != nil {
+		return err
+	}
+
+	if source != "" {
+		managed := append(loadManagedPlugins(dir), managedPlugin{
+			Filename: p.Filename,
+			Source:   source,
+			Project:  project,
+			Version:  p.Version,
+		})
+		if err = saveManagedPlugins(dir, managed); err != nil {
+			return err
+		}
+	}
+
+	L.Ok.Printf("%s %s installed in \"%s\"\n", p.Name, p.Version, s.Name)
+	return nil
+}
+
+// AddPlugin installs a plugin from a local jar
+func AddPlugin(s *Server, path string) error {
+	if err := checkCanChangePlugins(s); err != nil {
+		return err
+	}
+	return installPluginJar(s, path, "", "")
+}
+
+// hangarGet decodes the response of a Hangar API request
+func hangarGet(path string, query url.Values, out any) error {
+	u := strings.TrimRight(C.Hangar.URL, "/") + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	L.Debug.Printf("GET %s\n", u)
+	res, err := http.Get(u)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%s was not found on Hangar", path)
+	}
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("Hangar request %s failed: %s", path, res.Status)
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+// latestHangarVersion returns the newest Paper version of the project that
+// supports the Minecraft version
+func latestHangarVersion(project string, gameVersion string) (*remotePlugin, error) {
+	query := url.Values{}
+	query.Set("limit", "1")
+	query.Set("platform", "PAPER")
+	if _, ok := parseReleaseVersion(gameVersion); ok {
+		query.Set("platformVersion", gameVersion)
+	}
+
+	var versions struct {
+		Result []struct {
+			Name      string `json:"name"`
+			Downloads map[string]struct {
+				FileInfo *struct {
+					Name       string `json:"name"`
+					SHA256Hash string `json:"sha256Hash"`
+				} `json:"fileInfo"`
+				ExternalURL string `json:"externalUrl"`
+				DownloadURL string `json:"downloadUrl"`
+			} `json:"downloads"`
+		} `json:"result"`
+	}
+	if err := hangarGet("/projects/"+url.PathEscape(project)+"/versions", query, &versions); err != nil {
+		return nil, err
+	}
+	if len(versions.Result) == 0 {
+		return nil, fmt.Errorf("%s has no Paper version for Minecraft %s", project, gameVersion)
+	}
+
+	version := versions.Result[0]
+	download, ok := version.Downloads["PAPER"]
+	if !ok {
+		return nil, fmt.Errorf("%s %s cannot be downloaded for Paper", project, version.Name)
+	}
+	if download.DownloadURL == "" || download.FileInfo == nil {
+		return nil, fmt.Errorf("%s is hosted outside of Hangar, download it from %s", project, download.ExternalURL)
+	}
+
+	return &remotePlugin{
+		Version:  version.Name,
+		Filename: download.FileInfo.Name,
+		URL:      download.DownloadURL,
+		checksum: sha256Checksum(download.FileInfo.SHA256Hash),
+	}, nil
+}
+
+// latestModrinthPlugin returns the newest version of the project that runs on
+// Paper and supports the Minecraft version
+func latestModrinthPlugin(project string, gameVersion string) (*remotePlugin, error) {
+	version, err := latestModrinthVersion(project, modrinthPluginLoaders, gameVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := version.primaryFile()
+	if err != nil {
+		return nil, err
+	}
+
+	return &remotePlugin{
+		Version:  version.VersionNumber,
+		Filename: file.Filename,
+		URL:      file.URL,
+		checksum: file.checksum(),
+	}, nil
+}
+
+func latestPlugin(project string, source string, gameVersion string) (*remotePlugin, error) {
+	switch source {
+	case PluginSourceHangar:
+		return latestHangarVersion(project, gameVersion)
+	case PluginSourceModrinth:
+		return latestModrinthPlugin(project, gameVersion)
+	}
+	return nil, fmt.Errorf("Unknown plugin source %s", source)
+}
+
+// downloadPlugin downloads the plugin to a temporary folder, which has to be
+// removed by the caller
+func downloadPlugin(remote *remotePlugin, progress DownloadProgress) (string, string, error) {
+	tmp, err := os.MkdirTemp("", "plugin-")
+	if err != nil {
+		return "", "", err
+	}
+
+	if err = checkIllegalPath(tmp, remote.Filename); err != nil {
+		os.RemoveAll(tmp)
+		return "", "", err
+	}
+
+	path := filepath.Join(tmp, remote.Filename)
+	if err = downloadFile(remote.URL, path, remote.checksum, progress); err != nil {
+		os.RemoveAll(tmp)
+		return "", "", err
+	}
+	return tmp, path, nil
+}
+
+// AddPluginFromRepository installs the newest version of a Hangar or Modrinth
+// project compatible with the server
+func AddPluginFromRepository(s *Server, project string, source string, progress DownloadProgress) error {
+	if err := checkCanChangePlugins(s); err != nil {
+		return err
+	}
+
+	remote, err := latestPlugin(project, source, s.Version.ID)
+	if err != nil {
+		return err
+	}
+
+	L.Info.Printf("Downloading %s %s from %s\n", project, remote.Version, source)
+	tmp, path, err := downloadPlugin(remote, progress)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	return installPluginJar(s, path, source, project)
+}
+
+// RemovePlugin deletes the jar of a plugin, its data folder is kept
+func RemovePlugin(s *Server, name string) error {
+	if err := checkCanChangePlugins(s); err != nil {
+		return err
+	}
+
+	plugins, err := ListPlugins(s)
+	if err != nil {
+		return err
+	}
+	p := findPlugin(plugins, name)
+	if p == nil {
+		return fmt.Errorf("%s is not installed", name)
+	}
+
+	dir := s.PluginsDir()
+	if err = os.Remove(filepath.Join(dir, p.Filename)); err != nil {
+		return err
+	}
+
+	managed := []managedPlugin{}
+	for _, m := range loadManagedPlugins(dir) {
+		if m.Filename != p.Filename {
+			managed = append(managed, m)
+		}
+	}
+	if err = saveManagedPlugins(dir, managed); err != nil {
+		return err
+	}
+
+	L.Ok.Printf("%s removed from \"%s\"\n", p.Name, s.Name)
+	if _, err = os.Stat(filepath.Join(dir, p.Name)); err == nil {
+		L.Info.Printf("The data of %s is still in %s\n", p.Name, filepath.Join(dir, p.Name))
+	}
+	return nil
+}
+
+// UpdatePlugins moves the given plugins, or all the ones that were
+// downloaded by server-tool if none is given, to their newest version
+func UpdatePlugins(s *Server, names []string, progress DownloadProgress) error {
+	if err := checkCanChangePlugins(s); err != nil {
+		return err
+	}
+
+	plugins, err := ListPlugins(s)
+	if err != nil {
+		return err
+	}
+
+	toUpdate := []Plugin{}
+	if len(names) == 0 {
+		for _, p := range plugins {
+			if p.Source != "" {
+				toUpdate = append(toUpdate, p)
+			}
+		}
+	}
+	for _, name := range names {
+		p := findPlugin(plugins, name)
+		if p == nil {
+			return fmt.Errorf("%s is not installed", name)
+		}
+		if p.Source == "" {
+			return fmt.Errorf("%s was added by hand, replace %s to update it", p.Name, p.Filename)
+		}
+		toUpdate = append(toUpdate, *p)
+	}
+
+	dir := s.PluginsDir()
+	managed := loadManagedPlugins(dir)
+
+	for _, p := range toUpdate {
+		remote, err := latestPlugin(p.Project, p.Source, s.Version.ID)
+		if err != nil {
+			return err
+		}
+
+		var m *managedPlugin
+		for i := range managed {
+			if managed[i].Filename == p.Filename {
+				m = &managed[i]
+			}
+		}
+		if m.Version == remote.Version {
+			L.Info.Printf("%s is up to date\n", p.Name)
+			continue
+		}
+
+		L.Info.Printf("%s: %s -> %s\n", p.Name, m.Version, remote.Version)
+		tmp, path, err := downloadPlugin(remote, progress)
+		if err != nil {
+			return err
+		}
+
+		newPlugin, err := readPluginJar(path)
+		if err == nil {
+			warnIncompatiblePlugin(s, newPlugin)
+			// The old jar is removed only once the new one is in place
+			err = copyFile(path, filepath.Join(dir, remote.Filename), 0644)
+			if err == nil && remote.Filename != p.Filename {
+				err = os.Remove(filepath.Join(dir, p.Filename))
+			}
+		}
+		os.RemoveAll(tmp)
+		if err != nil {
+			return err
+		}
+
+		m.Filename = remote.Filename
+		m.Version = remote.Version
+		if err = saveManagedPlugins(dir, managed); err != nil {
+			return err
+		}
+	}
+	return nil
+}
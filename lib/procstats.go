@@ -0,0 +1,166 @@
+package lib
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+// ProcessStats is the resource usage of the server process at a point in time
+type ProcessStats struct {
+	// Resident memory in bytes
+	Memory uint64
+	// CPU time used since the start of the process
+	CPUTime time.Duration
+	// CPU usage since the previous sample, 100 is one core
+	CPU       float64
+	Threads   int
+	OpenFiles int
+}
+
+func (s ProcessStats) String() string {
+	return fmt.Sprintf("CPU %.0f%%, RAM %s, %d threads, %d open files",
+		s.CPU, humanize.IBytes(s.Memory), s.Threads, s.OpenFiles)
+}
+
+// ProcessMonitor is notified every time the usage of the server is sampled
+type ProcessMonitor interface {
+	Update(ProcessStats)
+	Done()
+}
+
+// ResourceUsage summarizes the usage of the server during a session
+type ResourceUsage struct {
+	PeakMemory    uint64
+	AverageMemory uint64
+	PeakCPU       float64
+	AverageCPU    float64
+	PeakThreads   int
+	PeakOpenFiles int
+}
+
+func (u *ResourceUsage) String() string {
+	return fmt.Sprintf("CPU %.0f%% on average (peak %.0f%%), RAM %s on average (peak %s), up to %d threads and %d open files",
+		u.AverageCPU, u.PeakCPU, humanize.IBytes(u.AverageMemory), humanize.IBytes(u.PeakMemory), u.PeakThreads, u.PeakOpenFiles)
+}
+
+type processSampler struct {
+	ui     ProcessMonitor
+	exited chan struct{}
+	done   chan struct{}
+
+	mutex      sync.Mutex
+	usage      ResourceUsage
+	samples    uint64
+	memorySum  uint64
+	cpuSamples uint64
+	cpuSum     float64
+}
+
+// newProcessSampler returns nil if the monitoring is disabled
+func newProcessSampler(ui ProcessMonitor) *processSampler {
+	if !C.Monitor.Enable || C.Monitor.Interval <= 0 {
+		return nil
+	}
+	return &processSampler{
+		ui:     ui,
+		exited: make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+}
+
+// watch samples the process until it exits, it is meant to be passed to
+// runCmdPrettyWatched
+func (m *processSampler) watch(p *os.Process) func() {
+	go m.loop(p.Pid)
+	return func() {
+		close(m.exited)
+		<-m.done
+	}
+}
+
+func (m *processSampler) add(stats ProcessStats, hasCPU bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	u := &m.usage
+	m.samples++
+	m.memorySum += stats.Memory
+	u.AverageMemory = m.memorySum / m.samples
+	if stats.Memory > u.PeakMemory {
+		u.PeakMemory = stats.Memory
+	}
+	if stats.Threads > u.PeakThreads {
+		u.PeakThreads = stats.Threads
+	}
+	if stats.OpenFiles > u.PeakOpenFiles {
+		u.PeakOpenFiles = stats.OpenFiles
+	}
+
+	if hasCPU {
+		m.cpuSamples++
+		m.cpuSum += stats.CPU
+		u.AverageCPU = m.cpuSum / float64(m.cpuSamples)
+		if stats.CPU > u.PeakCPU {
+			u.PeakCPU = stats.CPU
+		}
+	}
+}
+
+func (m *processSampler) loop(pid int) {
+	defer close(m.done)
+	if m.ui != nil {
+		defer m.ui.Done()
+	}
+
+	ticker := time.NewTicker(C.Monitor.Interval)
+	defer ticker.Stop()
+
+	lastSummary := time.Now()
+	var previous *ProcessStats
+	var previousTime time.Time
+	for {
+		select {
+		case <-m.exited:
+			return
+		case <-ticker.C:
+		}
+
+		stats, err := readProcessStats(pid)
+		if err != nil {
+			L.Debug.Printf("Unable to read the resource usage of the server: %v\n", err)
+			return
+		}
+
+		now := time.Now()
+		if previous != nil {
+			stats.CPU = float64(stats.CPUTime-previous.CPUTime) / float64(now.Sub(previousTime)) * 100
+		}
+		m.add(stats, previous != nil)
+		previous, previousTime = &stats, now
+
+		if m.ui != nil {
+			m.ui.Update(stats)
+		}
+
+		if C.Monitor.SummaryInterval > 0 && now.Sub(lastSummary) >= C.Monitor.SummaryInterval {
+			lastSummary = now
+			L.Info.Printf("Server usage: %s\n", m.result())
+		}
+	}
+}
+
+// result returns the usage so far, nil if no sample was taken
+func (m *processSampler) result() *ResourceUsage {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.samples == 0 {
+		return nil
+	}
+	usage := m.usage
+	return &usage
+}
@@ -0,0 +1,52 @@
+//go:build linux
+
+package lib
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Clock ticks per second used by /proc, it is 100 on every architecture Go
+// supports on Linux
+const clockTicks = 100
+
+// readProcessStats reads the resource usage of a process from /proc
+func readProcessStats(pid int) (ProcessStats, error) {
+	stats := ProcessStats{}
+	dir := filepath.Join("/proc", strconv.Itoa(pid))
+
+	b, err := os.ReadFile(filepath.Join(dir, "stat"))
+	if err != nil {
+		return stats, err
+	}
+
+	// The name of the command is between parentheses and can contain spaces,
+	// the fields after it start from the third one (state)
+	i := strings.LastIndexByte(string(b), ')')
+	if i < 0 {
+		return stats, fmt.Errorf("Invalid /proc/%d/stat", pid)
+	}
+	fields := strings.Fields(string(b[i+1:]))
+	if len(fields) < 22 {
+		return stats, fmt.Errorf("Invalid /proc/%d/stat", pid)
+	}
+	field := func(n int) uint64 {
+		v, _ := strconv.ParseUint(fields[n-3], 10, 64)
+		return v
+	}
+
+	ticks := field(14) + field(15)
+	stats.CPUTime = time.Duration(ticks) * time.Second / clockTicks
+	stats.Threads = int(field(20))
+	stats.Memory = field(24) * uint64(os.Getpagesize())
+
+	if entries, err := os.ReadDir(filepath.Join(dir, "fd")); err == nil {
+		stats.OpenFiles = len(entries)
+	}
+	return stats, nil
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package lib
+
+import "errors"
+
+func readProcessStats(pid int) (ProcessStats, error) {
+	return ProcessStats{}, errors.New("Resource usage can only be read on Linux")
+}
@@ -0,0 +1,209 @@
+package lib
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+)
+
+const PropertiesFileName = "server.properties"
+
+// Properties is a Java .properties file. Comments and the order of the keys
+// are preserved when the file is saved again.
+type Properties struct {
+	lines []string
+	keys  map[string]int
+}
+
+func NewProperties() *Properties {
+	return &Properties{
+		lines: []string{},
+		keys:  map[string]int{},
+	}
+}
+
+// LoadProperties reads a properties file, a missing file is considered empty
+func LoadProperties(path string) (*Properties, error) {
+	p := NewProperties()
+
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return p, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		p.lines = append(p.lines, line)
+
+		key, _, ok := parsePropertyLine(line)
+		if ok {
+			p.keys[key] = len(p.lines) - 1
+		}
+	}
+
+	return p, scanner.Err()
+}
+
+func parsePropertyLine(line string) (key string, value string, ok bool) {
+	trimmed := strings.TrimLeft(line, " \t")
+	if trimmed == "" || trimmed[0] == '#' || trimmed[0] == '!' {
+		return "", "", false
+	}
+
+	sep := -1
+	for i := 0; i < len(trimmed); i++ {
+		if trimmed[i] == '\\' {
+			i++
+			continue
+		}
+		if trimmed[i] == '=' || trimmed[i] == ':' {
+			sep = i
+			break
+		}
+	}
+	if sep == -1 {
+		return unescapeProperty(strings.TrimSpace(trimmed)), "", true
+	}
+
+	key = unescapeProperty(strings.TrimSpace(trimmed[:sep]))
+	value = unescapeProperty(strings.TrimLeft(trimmed[sep+1:], " \t"))
+	return key, value, true
+}
+
+func unescapeProperty(s string) string {
+	if !strings.Contains(s, "\\") {
+		return s
+	}
+
+	b := strings.Builder{}
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i == len(s)-1 {
+			b.WriteByte(s[i])
+			continue
+		}
+
+		i++
+		switch s[i] {
+		case 'n':
+			b.WriteByte('\n')
+		case 't':
+			b.WriteByte('\t')
+		case 'r':
+			b.WriteByte('\r')
+		case 'u':
+			if r, ok := parseUnicodeEscape(s, i); ok {
+				i += 4
+				// Java writes the characters outside the BMP as two
+				// escaped UTF-16 surrogates
+				if utf16.IsSurrogate(r) && i+2 < len(s) && s[i+1] == '\\' && s[i+2] == 'u' {
+					if low, ok := parseUnicodeEscape(s, i+2); ok {
+						if combined := utf16.DecodeRune(r, low); combined != unicode.ReplacementChar {
+							r = combined
+							i += 6
+						}
+					}
+				}
+				b.WriteRune(r)
+				continue
+			}
+			b.WriteByte('u')
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+// parseUnicodeEscape reads the 4 hex digits after the u at s[i]
+func parseUnicodeEscape(s string, i int) (rune, bool) {
+	if i+4 >= len(s) {
+		return 0, false
+	}
+	r, err := strconv.ParseUint(s[i+1:i+5], 16, 32)
+	return rune(r), err == nil
+}
+
+func escapeProperty(s string, isKey bool) string {
+	b := strings.Builder{}
+	for i, r := range s {
+		switch {
+		case r == '\\':
+			b.WriteString("\\\\")
+		case r == '\n':
+			b.WriteString("\\n")
+		case r == '\t':
+			b.WriteString("\\t")
+		case r == '\r':
+			b.WriteString("\\r")
+		case r == '=' || r == ':':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == ' ' && (isKey || i == 0):
+			b.WriteString("\\ ")
+		case r > 0x7e:
+			// Minecraft reads the file as UTF-8 but older versions used ISO-8859-1
+			if r > 0xffff {
+				high, low := utf16.EncodeRune(r)
+				fmt.Fprintf(&b, "\\u%04X\\u%04X", high, low)
+			} else {
+				fmt.Fprintf(&b, "\\u%04X", r)
+			}
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func (p *Properties) Get(key string) (string, bool) {
+	i, ok := p.keys[key]
+	if !ok {
+		return "", false
+	}
+	_, value, _ := parsePropertyLine(p.lines[i])
+	return value, true
+}
+
+// GetOr returns the value of key or def if the key is not set
+func (p *Properties) GetOr(key string, def string) string {
+	if value, ok := p.Get(key); ok {
+		return value
+	}
+	return def
+}
+
+func (p *Properties) Set(key string, value string) {
+	line := escapeProperty(key, true) + "=" + escapeProperty(value, false)
+	if i, ok := p.keys[key]; ok {
+		p.lines[i] = line
+		return
+	}
+	p.lines = append(p.lines, line)
+	p.keys[key] = len(p.lines) - 1
+}
+
+func (p *Properties) Save(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	for _, l := range p.lines {
+		if _, err = w.WriteString(l + "\n"); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
@@ -0,0 +1,210 @@
+package lib
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// A pendingPush is a commit that was made locally but could not be pushed,
+// usually because the remote was unreachable when the server was closed.
+type pendingPush struct {
+	BaseDir     string
+	QueuedAt    time.Time
+	Attempts    int
+	NextAttempt time.Time
+}
+
+const (
+	pushRetryBaseDelay = 30 * time.Second
+	pushRetryMaxDelay  = 6 * time.Hour
+)
+
+func PushQueuePath() string { return filepath.Join(C.Application.CacheDir, "push-queue.json") }
+
+func pushQueueKey(baseDir string) string {
+	abs, err := filepath.Abs(baseDir)
+	if err != nil {
+		return filepath.Clean(baseDir)
+	}
+	return abs
+}
+
+func pushRetryDelay(attempts int) time.Duration {
+	delay := pushRetryBaseDelay
+	for i := 0; i < attempts && delay < pushRetryMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > pushRetryMaxDelay {
+		delay = pushRetryMaxDelay
+	}
+	return delay
+}
+
+func loadPushQueue() ([]pendingPush, error) {
+	f, err := os.Open(PushQueuePath())
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return []pendingPush{}, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	queue := []pendingPush{}
+	if err = json.NewDecoder(f).Decode(&queue); err != nil {
+		L.Warn.Printf("The push queue is corrupted, ignoring it: %v\n", err)
+		return []pendingPush{}, nil
+	}
+	return queue, nil
+}
+
+func savePushQueue(queue []pendingPush) error {
+	if len(queue) == 0 {
+		err := os.Remove(PushQueuePath())
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	f, err := os.Create(PushQueuePath())
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	encoder := json.NewEncoder(f)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(queue)
+}
+
+func updatePushQueue(update func([]pendingPush) []pendingPush) error {
+	queue, err := loadPushQueue()
+	if err != nil {
+		return err
+	}
+	return savePushQueue(update(queue))
+}
+
+func enqueuePush(baseDir string) error {
+	key := pushQueueKey(baseDir)
+	return updatePushQueue(func(queue []pendingPush) []pendingPush {
+		for i := range queue {
+			if queue[i].BaseDir == key {
+				queue[i].Attempts++
+				queue[i].NextAttempt = time.Now().Add(pushRetryDelay(queue[i].Attempts))
+				return queue
+			}
+		}
+		return append(queue, pendingPush{
+			BaseDir:     key,
+			QueuedAt:    time.Now(),
+			Attempts:    1,
+			NextAttempt: time.Now().Add(pushRetryDelay(1)),
+		})
+	})
+}
+
+func dequeuePush(baseDir string) error {
+	key := pushQueueKey(baseDir)
+	return updatePushQueue(func(queue []pendingPush) []pendingPush {
+		result := []pendingPush{}
+		for _, p := range queue {
+			if p.BaseDir != key {
+				result = append(result, p)
+			}
+		}
+		return result
+	})
+}
+
+func HasPendingPush(baseDir string) bool {
+	queue, err := loadPushQueue()
+	if err != nil {
+		return false
+	}
+
+	key := pushQueueKey(baseDir)
+	for _, p := range queue {
+		if p.BaseDir == key {
+			return true
+		}
+	}
+	return false
+}
+
+// pushOrQueue pushes the current branch and, if that fails, remembers
+// that the server has unsynced changes instead of failing.
+func pushOrQueue(baseDir string) error {
+	err := RunCmdPretty(baseDir, "git", "push")
+	if err == nil {
+		return dequeuePush(baseDir)
+	}
+
+	L.Warn.Printf("Push failed, the changes will be pushed later: %v\n", err)
+	return enqueuePush(baseDir)
+}
+
+// SyncServer immediately tries to push the pending changes of a server,
+// ignoring the retry delay.
+func SyncServer(baseDir string) error {
+	if !C.Git.Enable {
+		return nil
+	}
+	if !hasGit {
+		return ErrGitNotInstalled
+	}
+
+	if !HasPendingPush(baseDir) {
+		L.Info.Printf("\"%s\" has no unsynced changes\n", baseDir)
+		return nil
+	}
+
+	err := RunCmdPretty(baseDir, "git", "push")
+	if err != nil {
+		if qErr := enqueuePush(baseDir); qErr != nil {
+			L.Warn.Printf("Unable to update the push queue: %v\n", qErr)
+		}
+		return err
+	}
+
+	L.Ok.Printf("\"%s\" is now in sync\n", baseDir)
+	return dequeuePush(baseDir)
+}
+
+// RetryPendingPushes tries to push every queued server whose retry delay has
+// expired. Failures are only logged since this runs on every launch.
+func RetryPendingPushes() {
+	if !C.Git.Enable || !hasGit {
+		return
+	}
+
+	queue, err := loadPushQueue()
+	if err != nil {
+		L.Warn.Printf("Unable to read the push queue: %v\n", err)
+		return
+	}
+
+	for _, p := range queue {
+		if time.Now().Before(p.NextAttempt) {
+			L.Debug.Printf("Next push attempt for \"%s\" is at %s\n", p.BaseDir, p.NextAttempt.Format(time.RFC3339))
+			continue
+		}
+
+		if _, err := os.Stat(p.BaseDir); err != nil {
+			L.Warn.Printf("\"%s\" does not exist anymore, removing it from the push queue\n", p.BaseDir)
+			if err = dequeuePush(p.BaseDir); err != nil {
+				L.Warn.Printf("Unable to update the push queue: %v\n", err)
+			}
+			continue
+		}
+
+		L.Info.Printf("Retrying to push unsynced changes of \"%s\"\n", p.BaseDir)
+		if err := pushOrQueue(p.BaseDir); err != nil {
+			L.Warn.Printf("Unable to update the push queue: %v\n", err)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+const (
+	// Next to the Minecraft port, away from the usual HTTP ones like the
+	// 8080 of the dashboard
+	defaultResourcePackPort = 25580
+	resourcePackProperty    = "resource-pack"
+	resourcePackSHA1        = "resource-pack-sha1"
+)
+
+// localAddress returns the address of this computer in the local network
+func localAddress() (string, error) {
+	// Nothing is sent, this only picks the interface of the default route
+	conn, err := net.Dial("udp", "8.8.8.8:80")
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).IP.String(), nil
+}
+
+// serveResourcePack serves the resource pack of the server, if it has one,
+// and writes its URL and hash to server.properties.
+// The returned function stops the HTTP server and restores the previous
+// properties, it must be called when the server stops.
+func serveResourcePack(s *Server) (func(), error) {
+	settings := s.Settings.ResourcePack
+	if settings.File == "" {
+		return func() {}, nil
+	}
+
+	if err := checkIllegalPath(s.BaseDir, settings.File); err != nil {
+		return nil, err
+	}
+	pack := filepath.Join(s.BaseDir, settings.File)
+	sum, err := hashFileSHA1(pack)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read the resource pack: %v", err)
+	}
+
+	host := C.ResourcePack.Host
+	if host == "" {
+		if host, err = localAddress(); err != nil {
+			return nil, fmt.Errorf("Unable to find the address of this computer, set resourcepack.host in the config: %v", err)
+		}
+		L.Warn.Printf("resourcepack.host is not set, the resource pack can only be downloaded from the local network\n")
+	}
+	port := settings.Port
+	if port == 0 {
+		port = defaultResourcePackPort
+	}
+
+	// Players download the pack from their computers, so it listens on
+	// every interface
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return nil, fmt.Errorf("Unable to serve the resource pack on port %d, another program may be using it. Choose another port with resourcepack.port in %s: %v", port, ServerSettingsFileName, err)
+	}
+
+	propsPath := filepath.Join(s.BaseDir, PropertiesFileName)
+	props, err := LoadProperties(propsPath)
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+	oldURL := props.GetOr(resourcePackProperty, "")
+	oldSHA1 := props.GetOr(resourcePackSHA1, "")
+
+	// The hash in the path makes clients download the pack again when it
+	// changes instead of using their cached copy
+	name := filepath.Base(pack)
+	path := "/" + sum + "/" + name
+	packURL := fmt.Sprintf("http://%s%s", net.JoinHostPort(host, strconv.Itoa(int(port))), (&url.URL{Path: path}).EscapedPath())
+
+	props.Set(resourcePackProperty, packURL)
+	props.Set(resourcePackSHA1, sum)
+	if err = props.Save(propsPath); err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != path {
+			http.NotFound(w, r)
+			return
+		}
+		L.Debug.Printf("Sending the resource pack to %s\n", r.RemoteAddr)
+		http.ServeFile(w, r, pack)
+	})
+	server := &http.Server{Handler: mux}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			L.Error.Printf("The resource pack server stopped: %v\n", err)
+		}
+	}()
+	L.Info.Printf("Serving %s at %s\n", settings.File, packURL)
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			L.Warn.Printf("Unable to stop the resource pack server: %v\n", err)
+		}
+
+		// server.properties is reloaded since the server may have changed it
+		props, err := LoadProperties(propsPath)
+		if err == nil {
+			props.Set(resourcePackProperty, oldURL)
+			props.Set(resourcePackSHA1, oldSHA1)
+			err = props.Save(propsPath)
+		}
+		if err != nil {
+			L.Warn.Printf("Unable to restore the resource pack in %s: %v\n", PropertiesFileName, err)
+		}
+	}, nil
+}
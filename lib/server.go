@@ -1,14 +1,14 @@
 package lib
 
 import (
-	"crypto/sha1"
-	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
-	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -17,31 +17,121 @@ type ServerType uint8
 const (
 	Vanilla ServerType = iota
 	Fabric
+	Paper
 )
 
-var serverStartTime *time.Time = nil
+func (t ServerType) String() string {
+	switch t {
+	case Vanilla:
+		return "vanilla"
+	case Fabric:
+		return "fabric"
+	case Paper:
+		return "paper"
+	}
+	return "unknown"
+}
+
+type VersionStatus uint8
+
+const (
+	// The hash of the jar was found in the manifest
+	VersionVerified VersionStatus = iota
+	// The version was read from the metadata inside the jar
+	VersionFromMetadata
+	// Nothing is known about the jar
+	VersionUnknown
+)
+
+const unknownVersionID = "unknown version"
+
+var (
+	ErrUnknownJavaVersion = errors.New("The Java version required by this server is unknown, choose one and try again")
+
+	// Java versions that can be chosen for servers with an unknown version
+	KnownJavaVersions = []int{8, 11, 17, 21}
+)
 
 type Server struct {
-	Name    string
-	BaseDir string
-	Version *VersionInfo
-	Type    ServerType
-	HasGit  bool
+	Name          string
+	BaseDir       string
+	Version       *VersionInfo
+	VersionStatus VersionStatus
+	Type          ServerType
+	HasGit        bool
+	JarName       string
+	Settings      ServerSettings
+
+	// Unsynced is true when some commits could not be pushed yet
+	Unsynced  bool
+	GitStatus GitStatus
 }
 
 type GitProgress func() func(string)
 
+// Console connects the server to something other than the terminal
+type Console struct {
+	// Read by the server as its standard input
+	Input io.Reader
+	// Receives the output of the server
+	Output io.Writer
+}
+
+// StartOptions are the optional parts of Start, the zero value runs the
+// server in the terminal
+type StartOptions struct {
+	// Notified of the resource usage of the server, if enabled
+	Monitor ProcessMonitor
+	// Used instead of the terminal if not nil
+	Console *Console
+}
+
 func (s *Server) PrettyName() string {
 	versionStr := s.Version.ID
+	// Paper jars are never in the manifest
+	if s.VersionStatus == VersionFromMetadata && s.Type != Paper {
+		versionStr += " (unverified jar)"
+	}
 	if s.Type == Fabric {
 		versionStr += " on Fabric"
+	} else if s.Type == Paper {
+		versionStr += " on Paper"
 	}
 	if s.HasGit {
 		versionStr += " + Git"
 	}
+	for _, status := range s.SyncStatus() {
+		versionStr += ", " + status
+	}
 	return fmt.Sprintf("%s (%s)", s.Name, versionStr)
 }
 
+// SyncStatus returns a short description of everything that should be known
+// about the repository before starting the server.
+func (s *Server) SyncStatus() []string {
+	result := []string{}
+	if !s.HasGit {
+		return result
+	}
+
+	if s.GitStatus.LockedBy != "" {
+		result = append(result, "locked by "+s.GitStatus.LockedBy)
+	}
+	if s.Unsynced {
+		result = append(result, "unsynced changes")
+	}
+	if s.GitStatus.Behind > 0 {
+		result = append(result, fmt.Sprintf("%d commits behind", s.GitStatus.Behind))
+	}
+	if s.GitStatus.Ahead > 0 {
+		result = append(result, fmt.Sprintf("%d commits ahead", s.GitStatus.Ahead))
+	}
+	if s.GitStatus.Dirty {
+		result = append(result, "uncommitted changes")
+	}
+	return result
+}
+
 const (
 	FabricJarName    = "fabric-server-launch.jar"
 	VanillaJarName   = "server.jar"
@@ -69,9 +159,23 @@ var (
 	}
 )
 
+// JavaVersion is the Java version the server runs with, the one chosen by
+// the user takes precedence over the detected one. It is 0 if unknown.
+func (s *Server) JavaVersion() int {
+	if s.Settings.JavaVersion != 0 {
+		return s.Settings.JavaVersion
+	}
+	return s.Version.JavaVersion
+}
+
 func ensureJavaPretty(s *Server, progress JavaDownloadProgress) (string, error) {
-	L.Debug.Printf("\"%s\" requires Java %d\n", s.Name, s.Version.JavaVersion)
-	javaExe, err := EnsureJavaIsInstalled(s.Version.JavaVersion, progress)
+	javaVersion := s.JavaVersion()
+	if javaVersion == 0 {
+		return "", ErrUnknownJavaVersion
+	}
+
+	L.Debug.Printf("\"%s\" requires Java %d\n", s.Name, javaVersion)
+	javaExe, err := EnsureJavaIsInstalled(javaVersion, progress)
 	if err != nil {
 		return "", err
 	}
@@ -79,21 +183,26 @@ func ensureJavaPretty(s *Server, progress JavaDownloadProgress) (string, error)
 	return javaExe, nil
 }
 
-func runJar(s *Server, gui bool, javaProgress JavaDownloadProgress) error {
+func runJar(s *Server, gui bool, javaProgress JavaDownloadProgress, monitor ProcessMonitor, stdin io.Reader, stdout io.Writer, extraArgs ...string) error {
 	javaExe, err := ensureJavaPretty(s, javaProgress)
 	if err != nil {
 		return err
 	}
 
+	memory := C.Minecraft.Memory
+	if s.Settings.Memory != 0 {
+		memory = s.Settings.Memory
+	}
+
 	args := []string{
-		fmt.Sprintf(minMemFlag, C.Minecraft.Memory),
-		fmt.Sprintf(maxMemFlag, C.Minecraft.Memory),
+		fmt.Sprintf(minMemFlag, memory),
+		fmt.Sprintf(maxMemFlag, memory),
 	}
 
 	args = append(args, javaArgs...)
 
-	if s.Type == Vanilla {
-		args = append(args, VanillaJarName)
+	if s.Type == Vanilla || s.Type == Paper {
+		args = append(args, s.JarName)
 	} else if s.Type == Fabric {
 		args = append(args, FabricJarName)
 	} else {
@@ -103,97 +212,271 @@ func runJar(s *Server, gui bool, javaProgress JavaDownloadProgress) error {
 	if !gui {
 		args = append(args, noGuiFlag)
 	}
+	args = append(args, extraArgs...)
 
 	java, err := filepath.Abs(javaExe)
 	if err != nil {
 		return err
 	}
 
-	return RunCmdPretty(
+	unmark := markRunning(s.BaseDir)
+	defer unmark()
+
+	watchers := []func(p *os.Process) func(){
+		func(p *os.Process) func() {
+			metricsServerStarted(s, p.Pid)
+			return func() { metricsServerStopped(s) }
+		},
+	}
+	dog := newWatchdog(s, java)
+	if dog != nil {
+		watchers = append(watchers, dog.watch)
+	}
+	sampler := newProcessSampler(monitor)
+	if sampler != nil {
+		watchers = append(watchers, sampler.watch)
+	}
+
+	err = runCmdPrettyWatched(
 		s.BaseDir,
+		stdin,
+		stdout,
+		func(p *os.Process) func() {
+			stops := []func(){}
+			for _, watch := range watchers {
+				stops = append(stops, watch(p))
+			}
+			return func() {
+				for _, stop := range stops {
+					stop()
+				}
+			}
+		},
 		java,
 		args...,
 	)
+
+	if sampler != nil {
+		if usage := sampler.result(); usage != nil {
+			L.Info.Printf("Server usage: %s\n", usage)
+			if currentSession != nil {
+				currentSession.Usage = usage
+			}
+		}
+	}
+	if dog != nil && dog.Hung() {
+		return ErrServerHung
+	}
+	return err
 }
 
-func (s *Server) Start(gui bool, javaProgress JavaDownloadProgress, gitProgress GitProgress) error {
+func (s *Server) Start(gui bool, javaProgress JavaDownloadProgress, gitProgress GitProgress, resolver DivergenceResolver, opts StartOptions) error {
 
-	serverStartTime = new(time.Time)
-	*serverStartTime = time.Now()
+	if err := checkServerEULA(s); err != nil {
+		return err
+	}
+
+	currentSession = newSession(s)
+	defer func() { currentSession = nil }()
 
 	if s.HasGit && C.Git.Enable {
-		if err := PreFn(s.BaseDir, gitProgress); err != nil {
+		start := time.Now()
+		err := PreFn(s.BaseDir, gitProgress, resolver)
+		metricsGitSync(s, "pre", start, err)
+		if err != nil {
 			return err
 		}
 	}
 
-	err := runJar(s, gui, javaProgress)
+	// The lock taken by PreFn has to be released if the server does not start
+	abort := func(err error) error {
+		if s.HasGit && C.Git.Enable {
+			if lockErr := releaseLock(s.BaseDir); lockErr != nil {
+				L.Warn.Printf("Unable to release the lock: %v\n", lockErr)
+			}
+		}
+		return err
+	}
+
+	// mods.lock could have been changed on another host
+	if s.Type == Fabric {
+		if err := SyncMods(s, javaProgress); err != nil {
+			return abort(err)
+		}
+	}
+
+	stopResourcePack, err := serveResourcePack(s)
 	if err != nil {
+		return abort(err)
+	}
+
+	var stdin io.Reader = os.Stdin
+	var stdout io.Writer
+	if opts.Console != nil {
+		stdin, stdout = opts.Console.Input, opts.Console.Output
+	}
+
+	err = runJar(s, gui, javaProgress, opts.Monitor, stdin, stdout)
+	// Restored before PostFn so that the URL of this host is not committed
+	stopResourcePack()
+	currentSession.finish(err)
+	// The world of a frozen server is usually fine, its changes are kept
+	hung := errors.Is(err, ErrServerHung)
+	if err != nil && !hung {
 		L.Error.Println("The server terminated with an error. Git will not update. You should first go figure out what happened to the server then git-unfuck")
 		return err
 	}
 
 	if s.HasGit && C.Git.Enable {
-		if err := PostFn(s.BaseDir, gitProgress); err != nil {
+		start := time.Now()
+		err := PostFn(s.BaseDir, gitProgress)
+		metricsGitSync(s, "post", start, err)
+		if err != nil {
 			return err
 		}
 	}
 
-	serverStartTime = nil
-
+	if hung {
+		return ErrServerHung
+	}
 	return nil
 }
 
-func FindServers(progress ManifestDownloadProgress) ([]Server, error) {
-	serverDirs, err := os.ReadDir(C.Application.WorkingDir)
+// inspectServerDir returns the server in the folder name of the working
+// directory, or nil if the folder does not contain a server. If fetch is true
+// the remote is fetched before reading the Git status.
+func inspectServerDir(name string, manifest *lazyManifest, cache *jarCache, fetch bool) (*Server, error) {
+	s := &Server{
+		Name:    name,
+		BaseDir: filepath.Join(C.Application.WorkingDir, name),
+	}
+
+	entries, err := os.ReadDir(s.BaseDir)
 	if err != nil {
 		return nil, err
 	}
 
-	servers := []Server{}
+	s.Settings, err = LoadServerSettings(s.BaseDir)
+	if err != nil {
+		L.Warn.Printf("Invalid %s in \"%s\": %v\n", ServerSettingsFileName, name, err)
+	}
 
-	for _, e := range serverDirs {
-		var s Server
-		s.BaseDir = filepath.Join(C.Application.WorkingDir, e.Name())
+	s.Type = Vanilla
+	otherJars := []string{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			if entry.Name() == VanillaJarName {
+				s.JarName = VanillaJarName
+			} else if entry.Name() == FabricJarName {
+				s.Type = Fabric
+			} else if filepath.Ext(entry.Name()) == ".jar" {
+				otherJars = append(otherJars, entry.Name())
+			}
+		} else {
+			if entry.Name() == GitDirectoryName {
+				s.HasGit = C.Git.Enable
+			}
+		}
+	}
 
-		if !e.IsDir() {
-			continue
+	if s.Settings.Jar != "" {
+		s.JarName = s.Settings.Jar
+	}
+
+	// A renamed jar is only considered if it is the only one and it
+	// looks like a server, otherwise we could pick up any jar.
+	requireMetadata := false
+	if s.JarName == "" && len(otherJars) == 1 {
+		s.JarName = otherJars[0]
+		requireMetadata = true
+	}
+
+	if s.JarName != "" {
+		err = detectServerVersion(filepath.Join(s.BaseDir, s.JarName), s, requireMetadata, manifest, cache)
+		if err != nil {
+			return nil, err
 		}
+	}
 
-		entries, err := os.ReadDir(s.BaseDir)
+	// New Fabric launchers download server.jar on the first start
+	if s.Version == nil && s.Type == Fabric {
+		err = detectServerVersion(filepath.Join(s.BaseDir, FabricJarName), s, true, manifest, cache)
 		if err != nil {
 			return nil, err
 		}
+		s.JarName = VanillaJarName
+	}
 
-		s.Type = Vanilla
-		isServer := false
-		for _, entry := range entries {
-			if !entry.IsDir() {
-				if entry.Name() == VanillaJarName {
-					possibleServerJar := filepath.Join(s.BaseDir, entry.Name())
-					err = detectServerVersion(possibleServerJar, &s, progress)
-					if err != nil {
-						return nil, err
-					}
-
-					if s.Version == nil {
-						// server.jar is not a Minecraft server
-						break
-					}
-					isServer = true
-				} else if entry.Name() == FabricJarName {
-					s.Type = Fabric
-				}
-			} else {
-				if entry.Name() == GitDirectoryName {
-					s.HasGit = C.Git.Enable
-				}
-			}
+	if s.Version == nil {
+		return nil, nil
+	}
+
+	if s.HasGit && hasGit {
+		s.Unsynced = HasPendingPush(s.BaseDir)
+		s.GitStatus, err = ReadGitStatus(s.BaseDir, fetch)
+		if err != nil {
+			L.Warn.Printf("Unable to read the Git status of \"%s\": %v\n", s.Name, err)
+		}
+	}
+
+	return s, nil
+}
+
+// Folders inspected at the same time, each one hashes a jar and runs git
+const serverScanWorkers = 4
+
+func FindServers(progress ManifestDownloadProgress) ([]Server, error) {
+	return findServers(progress, C.Git.FetchOnList)
+}
+
+// FindServersWithoutFetch is like FindServers but the Git status is read
+// without contacting the remotes, so it can be out of date. It is safe to use
+// while a server is being synchronized.
+func FindServersWithoutFetch(progress ManifestDownloadProgress) ([]Server, error) {
+	return findServers(progress, false)
+}
+
+func findServers(progress ManifestDownloadProgress, fetch bool) ([]Server, error) {
+	serverDirs, err := os.ReadDir(C.Application.WorkingDir)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &lazyManifest{progress: progress}
+	cache := loadJarCache()
+
+	// Folders are inspected in parallel, results keep the order of the folders
+	results := make([]*Server, len(serverDirs))
+	errs := make([]error, len(serverDirs))
+	wg := sync.WaitGroup{}
+	workers := make(chan struct{}, serverScanWorkers)
+
+	for i, e := range serverDirs {
+		if !e.IsDir() {
+			continue
 		}
 
-		s.Name = e.Name()
-		if isServer {
-			servers = append(servers, s)
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			workers <- struct{}{}
+			defer func() { <-workers }()
+			results[i], errs[i] = inspectServerDir(name, manifest, cache, fetch)
+		}(i, e.Name())
+	}
+	wg.Wait()
+
+	if err = cache.save(); err != nil {
+		L.Warn.Printf("Unable to save the jar cache: %v\n", err)
+	}
+
+	servers := []Server{}
+	for i := range serverDirs {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		if results[i] != nil {
+			servers = append(servers, *results[i])
 		}
 	}
 
@@ -204,78 +487,291 @@ func FindServers(progress ManifestDownloadProgress) ([]Server, error) {
 	return servers, nil
 }
 
-func detectServerVersion(serverJarPath string, s *Server, progress ManifestDownloadProgress) error {
-	infos, err := GetVersionInfos(progress)
+func findVersionByID(infos []VersionInfo, id string) *VersionInfo {
+	for _, v := range infos {
+		if v.ID == id {
+			return &v
+		}
+	}
+	return nil
+}
+
+// identifyJar looks up the hash of the jar in the manifest and, if it is not
+// there, reads the metadata inside the jar.
+func identifyJar(serverJarPath string, info os.FileInfo, manifest *lazyManifest) (jarCacheEntry, error) {
+	result := jarCacheEntry{
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+	}
+
+	sha, err := hashFileSHA1(serverJarPath)
 	if err != nil {
-		return err
+		return result, err
+	}
+	result.SHA1 = sha
+
+	infos, err := manifest.get()
+	if err != nil {
+		return result, err
+	}
+	result.ManifestModTime = manifestModTime()
+
+	for _, v := range infos {
+		if v.SHA == sha {
+			result.Version = &v
+			result.Status = VersionVerified
+			result.Recognized = true
+			return result, nil
+		}
+	}
+
+	meta, err := readJarMetadata(serverJarPath)
+	if err != nil {
+		L.Debug.Printf("Unable to read the metadata of %s: %v\n", serverJarPath, err)
+	}
+	if meta == nil {
+		return result, nil
+	}
+
+	result.Recognized = true
+	result.IsPaper = meta.IsPaper
+	result.Status = VersionFromMetadata
+	if v := findVersionByID(infos, meta.VersionID); v != nil {
+		result.Version = v
+		// The jar is not the one in the manifest
+		result.Version.SHA = sha
+	} else if meta.VersionID != "" {
+		result.Version = &VersionInfo{
+			ID:          meta.VersionID,
+			JavaVersion: meta.JavaVersion,
+			SHA:         sha,
+		}
+	} else {
+		result.Version = &VersionInfo{ID: unknownVersionID, SHA: sha}
+		result.Status = VersionUnknown
+	}
+
+	if meta.JavaVersion == 16 {
+		// See updateVersionInfos
+		meta.JavaVersion = 17
 	}
+	if meta.JavaVersion != 0 {
+		result.Version.JavaVersion = meta.JavaVersion
+	}
+	L.Debug.Printf("Detected version %s from the metadata of %s\n", result.Version.ID, serverJarPath)
+
+	return result, nil
+}
 
-	jar, err := os.Open(serverJarPath)
+// detectServerVersion sets the version of s from the jar at serverJarPath.
+// If requireMetadata is false a jar that cannot be recognised is still
+// considered a server with an unknown version.
+// Results are cached so that a jar is hashed only when it changes.
+func detectServerVersion(serverJarPath string, s *Server, requireMetadata bool, manifest *lazyManifest, cache *jarCache) error {
+	info, err := os.Stat(serverJarPath)
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
 			return nil
 		}
 		return err
 	}
-	defer jar.Close()
 
-	hasher := sha1.New()
-	_, err = io.Copy(hasher, jar)
-	if err != nil {
-		return err
+	result, ok := cache.get(serverJarPath, info)
+	if !ok {
+		result, err = identifyJar(serverJarPath, info, manifest)
+		if err != nil {
+			return err
+		}
+		cache.put(serverJarPath, result)
 	}
-	sha := hex.EncodeToString(hasher.Sum(nil))
 
-	for _, v := range infos {
-		if v.SHA == sha {
-			s.Version = &v
+	if !result.Recognized {
+		if requireMetadata {
 			return nil
 		}
+
+		L.Warn.Printf("Unable to detect the version of %s\n", serverJarPath)
+		s.Version = &VersionInfo{ID: unknownVersionID, SHA: result.SHA1}
+		s.VersionStatus = VersionUnknown
+		return nil
+	}
+
+	if result.IsPaper {
+		s.Type = Paper
+	}
+	s.Version = result.Version
+	s.VersionStatus = result.Status
+	return nil
+}
+
+// CreateOptions are the optional settings of a new server.
+// Empty values keep what is in the template or the Minecraft defaults.
+type CreateOptions struct {
+	// Template to copy in the server folder, nil for an empty server
+	Template *Template
+	// Vanilla or Fabric
+	Type ServerType
+	// Fabric loader version, empty for the latest one
+	FabricLoader string
+	Port         int
+	Seed         string
+	Gamemode     string
+	Difficulty   string
+	// Memory in megabytes, 0 to use the one in the config
+	Memory uint
+}
+
+var (
+	Gamemodes    = []string{"survival", "creative", "adventure", "spectator"}
+	Difficulties = []string{"peaceful", "easy", "normal", "hard"}
+)
+
+func isOneOf(value string, values []string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
 	}
+	return false
+}
 
+func (opts *CreateOptions) validate() error {
+	if opts.Type == Paper {
+		return errors.New("Paper servers cannot be created")
+	}
+	if opts.Port < 0 || opts.Port > 65535 {
+		return fmt.Errorf("Invalid port %d", opts.Port)
+	}
+	if opts.Gamemode != "" && !isOneOf(opts.Gamemode, Gamemodes) {
+		return fmt.Errorf("Invalid gamemode %s, use one of %s", opts.Gamemode, strings.Join(Gamemodes, ", "))
+	}
+	if opts.Difficulty != "" && !isOneOf(opts.Difficulty, Difficulties) {
+		return fmt.Errorf("Invalid difficulty %s, use one of %s", opts.Difficulty, strings.Join(Difficulties, ", "))
+	}
 	return nil
 }
 
-const eulaContent = "eula=true"
+// writeInitialProperties sets the properties chosen when creating the server
+// leaving the others to the template or to the Minecraft defaults
+func writeInitialProperties(s *Server, opts *CreateOptions) error {
+	port := ""
+	if opts.Port != 0 {
+		port = strconv.Itoa(opts.Port)
+	}
+	values := [][2]string{
+		{"server-port", port},
+		{"level-seed", opts.Seed},
+		{"gamemode", opts.Gamemode},
+		{"difficulty", opts.Difficulty},
+	}
 
-func CreateServer(s *Server) error {
-	err := os.MkdirAll(s.BaseDir, 0755)
+	path := filepath.Join(s.BaseDir, PropertiesFileName)
+	props, err := LoadProperties(path)
 	if err != nil {
 		return err
 	}
 
-	L.Info.Printf("Downloading server jar for version %s\n", s.Version.ID)
-	jar, err := os.Create(filepath.Join(s.BaseDir, "server.jar"))
-	if err != nil {
+	changed := false
+	for _, v := range values {
+		if v[1] != "" {
+			props.Set(v[0], v[1])
+			changed = true
+		}
+	}
+
+	if !changed {
+		return nil
+	}
+	return props.Save(path)
+}
+
+func CreateServer(s *Server, opts CreateOptions, progress DownloadProgress) (err error) {
+	if err := opts.validate(); err != nil {
+		return err
+	}
+
+	// Every UI creates servers through here, none of them must be able to
+	// overwrite an existing one
+	if _, err := validateServerName(s.Name); err != nil {
+		return err
+	}
+	if _, err := os.Stat(s.BaseDir); err == nil {
+		return fmt.Errorf("\"%s\" already exists", s.BaseDir)
+	} else if !errors.Is(err, os.ErrNotExist) {
 		return err
 	}
-	defer jar.Close()
 
-	res, err := http.Get(s.Version.JarURL)
+	if s.JarName == "" {
+		s.JarName = VanillaJarName
+	}
+
+	err = os.MkdirAll(s.BaseDir, 0755)
 	if err != nil {
 		return err
 	}
-	defer res.Body.Close()
+	// A half created server would only get in the way of a new attempt
+	defer func() {
+		if err != nil {
+			os.RemoveAll(s.BaseDir)
+		}
+	}()
+
+	if opts.Template != nil {
+		port := opts.Port
+		if port == 0 {
+			port = DefaultServerPort
+		}
+
+		err = opts.Template.apply(s.BaseDir, &TemplateData{
+			Name:    s.Name,
+			Version: s.Version.ID,
+			Port:    port,
+			Seed:    opts.Seed,
+		})
+		if err != nil {
+			return err
+		}
+
+		// The template can contain the settings of the server
+		if s.Settings, err = LoadServerSettings(s.BaseDir); err != nil {
+			return err
+		}
+	}
 
-	_, err = io.Copy(jar, res.Body)
+	if err = writeInitialProperties(s, &opts); err != nil {
+		return err
+	}
+
+	L.Info.Printf("Downloading server jar for version %s\n", s.Version.ID)
+	err = downloadFile(s.Version.JarURL, filepath.Join(s.BaseDir, VanillaJarName), sha1Checksum(s.Version.SHA), progress)
 	if err != nil {
 		return err
 	}
 
 	L.Ok.Println("Done!")
 
-	if !C.Minecraft.NoEULA {
-		eula, err := os.Create(filepath.Join(s.BaseDir, "eula.txt"))
-		if err != nil {
+	if opts.Type == Fabric {
+		if err = InstallFabric(s, opts.FabricLoader, progress); err != nil {
 			return err
 		}
-		defer eula.Close()
-		_, err = eula.Write([]byte(eulaContent))
-		if err != nil {
+	}
+
+	if opts.Memory != 0 {
+		s.Settings.Memory = opts.Memory
+	}
+	if opts.Memory != 0 || opts.Template != nil {
+		if err = s.SaveSettings(); err != nil {
 			return err
 		}
+	}
 
+	if HasAcceptedEULA() && !C.Minecraft.NoEULA {
+		if err = writeServerEULA(s.BaseDir); err != nil {
+			return err
+		}
 		L.Ok.Println("Eula accepted")
+	} else {
+		L.Warn.Printf("The EULA (%s) was not accepted, it will be asked when the server is started\n", EULAURL)
 	}
 
 	L.Ok.Println("[+] Server created successfully!")
@@ -0,0 +1,373 @@
+package lib
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+// A Session is a single run of a server, it is used to describe what
+// happened in the commit that is created when the server is closed.
+type Session struct {
+	Server  *Server
+	Start   time.Time
+	End     time.Time
+	Crashed bool
+	// Hung is set if the watchdog stopped the server
+	Hung bool
+	// Usage is nil if the resource usage was not monitored
+	Usage *ResourceUsage
+
+	// Upgrade is set if the session is an upgrade to a new Minecraft version
+	Upgrade *VersionChange
+}
+
+var currentSession *Session = nil
+
+// CommitMessageData is what is available to the commit message template
+type CommitMessageData struct {
+	Start            time.Time
+	End              time.Time
+	Duration         time.Duration
+	ToolVersion      string
+	User             string
+	Hostname         string
+	MinecraftVersion string
+	ServerType       string
+	Players          []string
+	Crashed          bool
+	Hung             bool
+	WorldSize        uint64
+	Usage            *ResourceUsage
+	Upgrade          *VersionChange
+}
+
+const DefaultCommitTemplate = `Server started at {{ .Start.Format "2006-01-02T15:04:05Z07:00" }}
+
+Time played: {{ .Duration }}
+{{- if .Players }}
+Players: {{ join .Players ", " }}
+{{- end }}
+{{- if .Hung }}
+The server froze and was stopped by the watchdog!
+{{- else if .Crashed }}
+The server crashed!
+{{- end }}
+server-tool version: {{ .ToolVersion }}`
+
+const (
+	trailerToolVersion      = "Server-Tool-Version"
+	trailerSessionStart     = "Session-Start"
+	trailerSessionEnd       = "Session-End"
+	trailerSessionHost      = "Session-Host"
+	trailerMinecraftVersion = "Minecraft-Version"
+	trailerServerType       = "Server-Type"
+	trailerPlayers          = "Session-Players"
+	trailerCrashed          = "Session-Crashed"
+	trailerWorldSize        = "World-Size"
+	trailerUpgradedFrom     = "Upgraded-From"
+	trailerPeakMemory       = "Session-Peak-Memory"
+	trailerAverageMemory    = "Session-Average-Memory"
+	trailerPeakCPU          = "Session-Peak-CPU"
+	trailerAverageCPU       = "Session-Average-CPU"
+	trailerPeakThreads      = "Session-Peak-Threads"
+	trailerPeakOpenFiles    = "Session-Peak-Open-Files"
+)
+
+var commitTemplateFuncs = template.FuncMap{
+	"join":  strings.Join,
+	"bytes": humanize.Bytes,
+}
+
+func newSession(s *Server) *Session {
+	return &Session{
+		Server: s,
+		Start:  time.Now(),
+	}
+}
+
+// finish records the end of the session. runErr is the error returned by
+// the server process, if any.
+func (session *Session) finish(runErr error) {
+	session.End = time.Now()
+	session.Crashed = runErr != nil || hasNewCrashReport(session.Server.BaseDir, session.Start)
+	session.Hung = errors.Is(runErr, ErrServerHung)
+}
+
+func hasNewCrashReport(baseDir string, since time.Time) bool {
+	entries, err := os.ReadDir(filepath.Join(baseDir, "crash-reports"))
+	if err != nil {
+		return false
+	}
+
+	for _, e := range entries {
+		info, err := e.Info()
+		if err == nil && info.ModTime().After(since) {
+			return true
+		}
+	}
+	return false
+}
+
+var playerJoinedRegex = regexp.MustCompile(`\]: ([A-Za-z0-9_]{1,16}) joined the game`)
+
+// sessionPlayers reads the players that joined from the latest server log,
+// which is rotated by the server every time it starts.
+func sessionPlayers(baseDir string) []string {
+	players := []string{}
+
+	f, err := os.Open(filepath.Join(baseDir, "logs", "latest.log"))
+	if err != nil {
+		return players
+	}
+	defer f.Close()
+
+	seen := map[string]bool{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		m := playerJoinedRegex.FindStringSubmatch(scanner.Text())
+		if m != nil && !seen[m[1]] {
+			seen[m[1]] = true
+			players = append(players, m[1])
+		}
+	}
+	return players
+}
+
+func worldDirs(baseDir string) []string {
+	levelName := "world"
+	if props, err := LoadProperties(filepath.Join(baseDir, PropertiesFileName)); err == nil {
+		levelName = props.GetOr("level-name", levelName)
+	}
+
+	// Bukkit based servers keep the other dimensions in separate folders
+	dirs := []string{}
+	for _, name := range []string{levelName, levelName + "_nether", levelName + "_the_end"} {
+		dir := filepath.Join(baseDir, name)
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+func dirSize(dir string) (size uint64) {
+	_ = filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info, err := d.Info(); err == nil && info.Mode().IsRegular() {
+			size += uint64(info.Size())
+		}
+		return nil
+	})
+	return
+}
+
+func hostUser() string {
+	if name, err := getGitUsername(); err == nil && name != "" {
+		return name
+	}
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return "????"
+}
+
+func (session *Session) commitMessageData() CommitMessageData {
+	data := CommitMessageData{
+		Start:       session.Start,
+		End:         session.End,
+		Duration:    session.End.Sub(session.Start).Round(time.Second),
+		ToolVersion: Version,
+		User:        hostUser(),
+		Crashed:     session.Crashed,
+		Hung:        session.Hung,
+		Usage:       session.Usage,
+		Upgrade:     session.Upgrade,
+	}
+	data.Hostname, _ = os.Hostname()
+
+	s := session.Server
+	if s.Version != nil {
+		data.MinecraftVersion = s.Version.ID
+	}
+	data.ServerType = s.Type.String()
+	data.Players = sessionPlayers(s.BaseDir)
+	for _, dir := range worldDirs(s.BaseDir) {
+		data.WorldSize += dirSize(dir)
+	}
+
+	return data
+}
+
+func (data *CommitMessageData) trailers() string {
+	trailers := [][2]string{
+		{trailerToolVersion, data.ToolVersion},
+		{trailerSessionStart, data.Start.Format(time.RFC3339)},
+		{trailerSessionEnd, data.End.Format(time.RFC3339)},
+		{trailerSessionHost, fmt.Sprintf("%s@%s", data.User, data.Hostname)},
+		{trailerMinecraftVersion, data.MinecraftVersion},
+		{trailerServerType, data.ServerType},
+		{trailerPlayers, strings.Join(data.Players, ", ")},
+		{trailerCrashed, strconv.FormatBool(data.Crashed)},
+		{trailerWorldSize, strconv.FormatUint(data.WorldSize, 10)},
+	}
+	if data.Upgrade != nil {
+		trailers = append(trailers, [2]string{trailerUpgradedFrom, data.Upgrade.From})
+	}
+	if u := data.Usage; u != nil {
+		trailers = append(trailers,
+			[2]string{trailerPeakMemory, strconv.FormatUint(u.PeakMemory, 10)},
+			[2]string{trailerAverageMemory, strconv.FormatUint(u.AverageMemory, 10)},
+			[2]string{trailerPeakCPU, strconv.FormatFloat(u.PeakCPU, 'f', 1, 64)},
+			[2]string{trailerAverageCPU, strconv.FormatFloat(u.AverageCPU, 'f', 1, 64)},
+			[2]string{trailerPeakThreads, strconv.Itoa(u.PeakThreads)},
+			[2]string{trailerPeakOpenFiles, strconv.Itoa(u.PeakOpenFiles)},
+		)
+	}
+
+	b := strings.Builder{}
+	for _, t := range trailers {
+		fmt.Fprintf(&b, "%s: %s\n", t[0], strings.ReplaceAll(t[1], "\n", " "))
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// commitMessage renders the configured template and appends the trailer
+// block that can be read back with ParseSessionRecord.
+func (session *Session) commitMessage() string {
+	data := session.commitMessageData()
+
+	if data.Upgrade != nil {
+		return fmt.Sprintf("Upgrade from %s to %s\n\nserver-tool version: %s\n\n%s",
+			data.Upgrade.From, data.Upgrade.To, data.ToolVersion, data.trailers())
+	}
+
+	tmplStr := C.Git.CommitTemplate
+	if strings.TrimSpace(tmplStr) == "" {
+		tmplStr = DefaultCommitTemplate
+	}
+
+	b := strings.Builder{}
+	tmpl, err := template.New("commit").Funcs(commitTemplateFuncs).Parse(tmplStr)
+	if err == nil {
+		err = tmpl.Execute(&b, &data)
+	}
+	if err != nil {
+		L.Warn.Printf("Invalid commit message template, using the default one: %v\n", err)
+		b.Reset()
+		tmpl = template.Must(template.New("commit").Funcs(commitTemplateFuncs).Parse(DefaultCommitTemplate))
+		if err = tmpl.Execute(&b, &data); err != nil {
+			panic(err)
+		}
+	}
+
+	return strings.TrimSpace(b.String()) + "\n\n" + data.trailers()
+}
+
+// A SessionRecord is a session read back from the Git history
+type SessionRecord struct {
+	Commit           string
+	ToolVersion      string
+	Start            time.Time
+	End              time.Time
+	Host             string
+	MinecraftVersion string
+	ServerType       string
+	Players          []string
+	Crashed          bool
+	WorldSize        uint64
+
+	// UpgradedFrom is set if the session was an upgrade from this version
+	UpgradedFrom string
+	// Usage is nil if the resource usage was not monitored
+	Usage *ResourceUsage
+}
+
+// ParseSessionRecord reads the trailer block of a commit message. It returns
+// nil if the message was not created at the end of a session.
+func ParseSessionRecord(message string) *SessionRecord {
+	paragraphs := strings.Split(strings.TrimSpace(strings.ReplaceAll(message, "\r", "")), "\n\n")
+	trailers := map[string]string{}
+	for _, line := range strings.Split(paragraphs[len(paragraphs)-1], "\n") {
+		key, value, ok := strings.Cut(line, ": ")
+		if !ok {
+			// Trailers without a value have no space after the colon
+			key, value, ok = strings.Cut(line, ":")
+			if !ok {
+				continue
+			}
+		}
+		trailers[key] = strings.TrimSpace(value)
+	}
+
+	start, err := time.Parse(time.RFC3339, trailers[trailerSessionStart])
+	if err != nil {
+		return nil
+	}
+
+	r := &SessionRecord{
+		ToolVersion:      trailers[trailerToolVersion],
+		Start:            start,
+		Host:             trailers[trailerSessionHost],
+		MinecraftVersion: trailers[trailerMinecraftVersion],
+		ServerType:       trailers[trailerServerType],
+		Players:          []string{},
+		UpgradedFrom:     trailers[trailerUpgradedFrom],
+	}
+	r.End, _ = time.Parse(time.RFC3339, trailers[trailerSessionEnd])
+	r.Crashed, _ = strconv.ParseBool(trailers[trailerCrashed])
+	r.WorldSize, _ = strconv.ParseUint(trailers[trailerWorldSize], 10, 64)
+	if players := trailers[trailerPlayers]; players != "" {
+		r.Players = strings.Split(players, ", ")
+	}
+	if _, ok := trailers[trailerPeakMemory]; ok {
+		u := &ResourceUsage{}
+		u.PeakMemory, _ = strconv.ParseUint(trailers[trailerPeakMemory], 10, 64)
+		u.AverageMemory, _ = strconv.ParseUint(trailers[trailerAverageMemory], 10, 64)
+		u.PeakCPU, _ = strconv.ParseFloat(trailers[trailerPeakCPU], 64)
+		u.AverageCPU, _ = strconv.ParseFloat(trailers[trailerAverageCPU], 64)
+		u.PeakThreads, _ = strconv.Atoi(trailers[trailerPeakThreads])
+		u.PeakOpenFiles, _ = strconv.Atoi(trailers[trailerPeakOpenFiles])
+		r.Usage = u
+	}
+
+	return r
+}
+
+// SessionHistory returns the sessions recorded in the Git history of a
+// server, the most recent first.
+func SessionHistory(baseDir string) ([]SessionRecord, error) {
+	if !hasGit {
+		return nil, ErrGitNotInstalled
+	}
+
+	out, err := gitOutput(baseDir, "log", "--format=%H%x00%B%x00")
+	if err != nil {
+		return nil, err
+	}
+
+	records := []SessionRecord{}
+	fields := strings.Split(out, "\x00")
+	for i := 0; i+1 < len(fields); i += 2 {
+		r := ParseSessionRecord(fields[i+1])
+		if r == nil {
+			continue
+		}
+		r.Commit = strings.TrimSpace(fields[i])
+		records = append(records, *r)
+	}
+	return records, nil
+}
@@ -0,0 +1,77 @@
+package lib
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const ServerSettingsFileName = "server-tool.yml"
+
+// ServerSettings are the settings of a single server. They are stored in the
+// server folder so that they are shared through Git with the other hosts.
+type ServerSettings struct {
+	// Java version to use when it cannot be detected from the server jar
+	JavaVersion int `yaml:",omitempty"`
+
+	// Name of the server jar if it is not server.jar
+	Jar string `yaml:",omitempty"`
+
+	// Memory to give to this server in megabytes, overrides the config
+	Memory uint `yaml:",omitempty"`
+
+	// Minecraft versions this server was upgraded from
+	VersionHistory []VersionChange `yaml:",omitempty"`
+
+	// Resource pack served to the players while the server runs
+	ResourcePack ResourcePackSettings `yaml:",omitempty"`
+}
+
+type ResourcePackSettings struct {
+	// Path of the pack zip relative to the server folder, empty to disable
+	File string `yaml:",omitempty"`
+	// Port of the HTTP server, 25580 if not set
+	Port uint16 `yaml:",omitempty"`
+}
+
+type VersionChange struct {
+	From string
+	To   string
+	Date time.Time
+}
+
+func LoadServerSettings(baseDir string) (ServerSettings, error) {
+	settings := ServerSettings{}
+
+	f, err := os.Open(filepath.Join(baseDir, ServerSettingsFileName))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return settings, nil
+		}
+		return settings, err
+	}
+	defer f.Close()
+
+	err = yaml.NewDecoder(f).Decode(&settings)
+	if errors.Is(err, io.EOF) {
+		// The file is empty
+		err = nil
+	}
+	return settings, err
+}
+
+func (s *Server) SaveSettings() error {
+	f, err := os.Create(filepath.Join(s.BaseDir, ServerSettingsFileName))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	encoder := yaml.NewEncoder(f)
+	encoder.SetIndent(2)
+	return encoder.Encode(&s.Settings)
+}
@@ -0,0 +1,171 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A Snapshot is the state of a server before an unfuck operation or an upgrade.
+// Commits are kept in a branch while the working tree, including untracked
+// and ignored files, is saved in an archive in the cache folder.
+type Snapshot struct {
+	BaseDir string
+	Archive string
+	Branch  string
+	Created time.Time
+}
+
+const (
+	snapshotBranchPrefix  = "server-tool/snapshot-"
+	snapshotTimeFormat    = "2006-01-02T15-04-05"
+	maxSnapshotsPerServer = 3
+)
+
+func SnapshotsDir() string { return filepath.Join(C.Application.CacheDir, "snapshots") }
+
+func (s *Snapshot) Name() string { return s.Created.Format(snapshotTimeFormat) }
+
+func snapshotArchivePrefix(baseDir string) string {
+	return filepath.Base(pushQueueKey(baseDir)) + "@"
+}
+
+func createSnapshot(baseDir string) (*Snapshot, error) {
+	if err := os.MkdirAll(SnapshotsDir(), 0700); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	snap := &Snapshot{
+		BaseDir: baseDir,
+		Archive: filepath.Join(SnapshotsDir(), snapshotArchivePrefix(baseDir)+now.Format(snapshotTimeFormat)+".tar.gz"),
+		Branch:  snapshotBranchPrefix + now.Format(snapshotTimeFormat),
+		Created: now,
+	}
+
+	L.Info.Printf("Creating a snapshot of \"%s\" at %s\n", baseDir, snap.Archive)
+
+	// An empty repository has no HEAD to point the branch to
+	if _, err := gitOutput(baseDir, "rev-parse", "--verify", "HEAD"); err == nil {
+		if err = RunCmdPretty(baseDir, "git", "branch", snap.Branch); err != nil {
+			return nil, err
+		}
+	} else {
+		snap.Branch = ""
+	}
+
+	f, err := os.Create(snap.Archive)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	err = Targz(f, baseDir, func(rel string) bool { return rel == GitDirectoryName })
+	if err != nil {
+		f.Close()
+		os.Remove(snap.Archive)
+		if snap.Branch != "" {
+			_ = RunCmdPretty(baseDir, "git", "branch", "-D", snap.Branch)
+		}
+		return nil, err
+	}
+
+	L.Ok.Printf("Snapshot %s created\n", snap.Name())
+
+	pruneSnapshots(baseDir)
+	return snap, nil
+}
+
+func ListSnapshots(baseDir string) ([]Snapshot, error) {
+	prefix := snapshotArchivePrefix(baseDir)
+	entries, err := os.ReadDir(SnapshotsDir())
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return []Snapshot{}, nil
+		}
+		return nil, err
+	}
+
+	snapshots := []Snapshot{}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasPrefix(e.Name(), prefix) || !strings.HasSuffix(e.Name(), ".tar.gz") {
+			continue
+		}
+
+		name := strings.TrimSuffix(strings.TrimPrefix(e.Name(), prefix), ".tar.gz")
+		created, err := time.ParseInLocation(snapshotTimeFormat, name, time.Local)
+		if err != nil {
+			continue
+		}
+
+		snap := Snapshot{
+			BaseDir: baseDir,
+			Archive: filepath.Join(SnapshotsDir(), e.Name()),
+			Branch:  snapshotBranchPrefix + name,
+			Created: created,
+		}
+		if _, err := gitOutput(baseDir, "rev-parse", "--verify", "refs/heads/"+snap.Branch); err != nil {
+			snap.Branch = ""
+		}
+		snapshots = append(snapshots, snap)
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].Created.After(snapshots[j].Created) })
+	return snapshots, nil
+}
+
+func pruneSnapshots(baseDir string) {
+	snapshots, err := ListSnapshots(baseDir)
+	if err != nil {
+		L.Warn.Printf("Unable to list snapshots: %v\n", err)
+		return
+	}
+
+	for i := maxSnapshotsPerServer; i < len(snapshots); i++ {
+		L.Debug.Printf("Removing old snapshot %s\n", snapshots[i].Name())
+		if err = os.Remove(snapshots[i].Archive); err != nil {
+			L.Warn.Printf("Unable to remove %s: %v\n", snapshots[i].Archive, err)
+		}
+		if snapshots[i].Branch != "" {
+			if err = RunCmdPretty(baseDir, "git", "branch", "-D", snapshots[i].Branch); err != nil {
+				L.Warn.Printf("Unable to remove branch %s: %v\n", snapshots[i].Branch, err)
+			}
+		}
+	}
+}
+
+// RestoreSnapshot brings the server back to the state it was in when the
+// snapshot was taken, discarding everything that happened after.
+func RestoreSnapshot(snap *Snapshot) error {
+	L.Warn.Printf("Restoring snapshot %s of \"%s\"\n", snap.Name(), snap.BaseDir)
+
+	f, err := os.Open(snap.Archive)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if snap.Branch != "" {
+		if err = RunCmdPretty(snap.BaseDir, "git", "reset", "--hard", snap.Branch); err != nil {
+			return err
+		}
+	}
+
+	if err = RunCmdPretty(snap.BaseDir, "git", "clean", "-fdx"); err != nil {
+		return err
+	}
+
+	err = Untargz(f, snap.BaseDir, "", func(name string) {
+		L.Debug.Printf("Restoring %s\n", name)
+	})
+	if err != nil {
+		return fmt.Errorf("Unable to extract %s: %v", snap.Archive, err)
+	}
+
+	L.Ok.Printf("Snapshot %s restored\n", snap.Name())
+	return nil
+}
@@ -0,0 +1,149 @@
+package lib
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// A Template is a folder or an archive in TemplatesDir whose content is
+// copied in the new servers
+type Template struct {
+	Name string
+	Path string
+}
+
+// TemplateData are the variables available in the template files
+type TemplateData struct {
+	Name    string
+	Version string
+	Port    int
+	Seed    string
+}
+
+const DefaultServerPort = 25565
+
+// Only the files with these extensions are processed with text/template
+var templateTextExtensions = map[string]bool{
+	".properties": true,
+	".json":       true,
+	".yml":        true,
+	".yaml":       true,
+	".toml":       true,
+	".txt":        true,
+	".cfg":        true,
+	".conf":       true,
+	".mcmeta":     true,
+}
+
+func TemplatesDir() (string, error) {
+	_, configDir, err := GetConfigPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "templates"), nil
+}
+
+func (t *Template) isArchive() bool { return archiveFormat(t.Path) != "" }
+
+// ListTemplates returns the templates found in TemplatesDir
+func ListTemplates() ([]Template, error) {
+	dir, err := TemplatesDir()
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return []Template{}, nil
+		}
+		return nil, err
+	}
+
+	templates := []Template{}
+	for _, e := range entries {
+		t := Template{
+			Name: e.Name(),
+			Path: filepath.Join(dir, e.Name()),
+		}
+		if !e.IsDir() {
+			if !t.isArchive() {
+				continue
+			}
+			t.Name = strings.TrimSuffix(t.Name, archiveFormat(t.Name))
+		}
+		templates = append(templates, t)
+	}
+	return templates, nil
+}
+
+func FindTemplate(name string) (*Template, error) {
+	templates, err := ListTemplates()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, t := range templates {
+		if t.Name == name {
+			return &t, nil
+		}
+	}
+
+	dir, _ := TemplatesDir()
+	return nil, fmt.Errorf("Template %s not found in %s", name, dir)
+}
+
+func expandTemplateFile(path string, data *TemplateData) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	tmpl, err := template.New(filepath.Base(path)).Option("missingkey=error").Parse(string(b))
+	if err != nil {
+		// Files that just happen to contain braces are copied as they are
+		L.Warn.Printf("%s is not a valid template, copying it unchanged: %v\n", filepath.Base(path), err)
+		return nil
+	}
+
+	var out bytes.Buffer
+	if err = tmpl.Execute(&out, data); err != nil {
+		return fmt.Errorf("Unable to apply the template to %s: %v", filepath.Base(path), err)
+	}
+	return os.WriteFile(path, out.Bytes(), info.Mode().Perm())
+}
+
+// apply copies the template in dest, replacing the variables in the text files
+func (t *Template) apply(dest string, data *TemplateData) error {
+	L.Info.Printf("Applying template %s\n", t.Name)
+
+	var err error
+	if t.isArchive() {
+		err = extractArchive(t.Path, dest)
+	} else {
+		err = copyDir(t.Path, dest)
+	}
+	if err != nil {
+		return err
+	}
+
+	return filepath.WalkDir(dest, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !templateTextExtensions[strings.ToLower(filepath.Ext(p))] {
+			return nil
+		}
+		return expandTemplateFile(p, data)
+	})
+}
@@ -0,0 +1,144 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type UpgradeOptions struct {
+	// Allow to move to an older version
+	Force bool
+	// Run the server once with --forceUpgrade to upgrade all the chunks
+	ForceUpgrade bool
+}
+
+var (
+	ErrDowngrade = errors.New("The target version is older than the current one, force the upgrade to downgrade the server")
+)
+
+const forceUpgradeFlag = "--forceUpgrade"
+
+func checkUpgrade(s *Server, target *VersionInfo, opts UpgradeOptions) error {
+	if s.Type == Paper {
+		return fmt.Errorf("Upgrading Paper servers is not supported, replace %s with the new Paper jar", s.JarName)
+	}
+
+	if s.Version.ID == target.ID && s.VersionStatus == VersionVerified {
+		return fmt.Errorf("\"%s\" is already on version %s", s.Name, target.ID)
+	}
+
+	if s.Version.ReleaseDate.IsZero() {
+		if !opts.Force {
+			return fmt.Errorf("The current version of \"%s\" is unknown so it is not possible to tell if this is a downgrade. Force the upgrade to continue", s.Name)
+		}
+	} else if target.ReleaseDate.Before(s.Version.ReleaseDate) {
+		if !opts.Force {
+			return ErrDowngrade
+		}
+		L.Warn.Printf("Downgrading \"%s\" from %s to %s\n", s.Name, s.Version.ID, target.ID)
+	}
+
+	if s.Type == Fabric {
+		// The launcher has to be replaced too, it contains the mappings of
+		// the old version
+		if _, _, err := latestFabricVersions(target.ID, ""); err != nil {
+			return err
+		}
+		L.Warn.Println("Fabric mods might not work with the new version, remember to update them")
+	}
+
+	return nil
+}
+
+// UpgradeServer replaces the server jar with the one of target.
+// A snapshot is taken before the jar is replaced, if the server uses Git the
+// upgrade is committed like a normal session.
+func UpgradeServer(s *Server, target *VersionInfo, opts UpgradeOptions, javaProgress JavaDownloadProgress, gitProgress GitProgress, resolver DivergenceResolver) error {
+	if err := checkUpgrade(s, target, opts); err != nil {
+		return err
+	}
+	if opts.ForceUpgrade {
+		if err := checkServerEULA(s); err != nil {
+			return err
+		}
+	}
+
+	useGit := s.HasGit && C.Git.Enable
+	change := VersionChange{
+		From: s.Version.ID,
+		To:   target.ID,
+		Date: time.Now(),
+	}
+
+	currentSession = newSession(s)
+	currentSession.Upgrade = &change
+	defer func() { currentSession = nil }()
+
+	if useGit {
+		if err := PreFn(s.BaseDir, gitProgress, resolver); err != nil {
+			return err
+		}
+	}
+
+	// Until the jar is replaced nothing has changed, so we can give the lock back
+	jarReplaced := false
+	fail := func(err error) error {
+		if useGit && !jarReplaced {
+			if lockErr := releaseLock(s.BaseDir); lockErr != nil {
+				L.Warn.Printf("Unable to release the lock: %v\n", lockErr)
+			}
+		} else if jarReplaced {
+			L.Error.Println("The upgrade failed after the jar was replaced. You can go back with the snapshot taken before the upgrade")
+		}
+		return err
+	}
+
+	snap, err := createSnapshot(s.BaseDir)
+	if err != nil {
+		return fail(err)
+	}
+
+	if s.JarName == "" {
+		s.JarName = VanillaJarName
+	}
+
+	L.Info.Printf("Upgrading \"%s\" from %s to %s\n", s.Name, change.From, change.To)
+	err = downloadFile(target.JarURL, filepath.Join(s.BaseDir, s.JarName), sha1Checksum(target.SHA), javaProgress)
+	if err != nil {
+		return fail(err)
+	}
+	jarReplaced = true
+
+	s.Version = target
+	s.VersionStatus = VersionVerified
+	if s.Type == Fabric {
+		if err = InstallFabric(s, "", javaProgress); err != nil {
+			return fail(err)
+		}
+	}
+	s.Settings.VersionHistory = append(s.Settings.VersionHistory, change)
+	if err = s.SaveSettings(); err != nil {
+		return fail(err)
+	}
+
+	if opts.ForceUpgrade {
+		L.Info.Println("Running the server once to upgrade the world, it will stop by itself when done")
+		err = runJar(s, false, javaProgress, nil, strings.NewReader("stop\n"), nil, forceUpgradeFlag)
+		if err != nil {
+			return fail(err)
+		}
+	}
+	currentSession.finish(nil)
+
+	if useGit {
+		if err = PostFn(s.BaseDir, gitProgress); err != nil {
+			return err
+		}
+	}
+
+	L.Ok.Printf("\"%s\" upgraded to %s. Snapshot %s contains the previous version\n", s.Name, target.ID, snap.Name())
+	return nil
+}
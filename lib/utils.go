@@ -2,6 +2,8 @@ package lib
 
 import (
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
 	"os/exec"
 	"path"
@@ -27,6 +29,17 @@ func MakeCacheDir() (err error) {
 }
 
 func RunCmdPretty(workDir string, name string, args ...string) error {
+	return runCmdPrettyWithInput(workDir, os.Stdin, name, args...)
+}
+
+func runCmdPrettyWithInput(workDir string, stdin io.Reader, name string, args ...string) error {
+	return runCmdPrettyWatched(workDir, stdin, nil, nil, name, args...)
+}
+
+// runCmdPrettyWatched runs the command like RunCmdPretty, its output goes to
+// stdout if it is not nil. If watch is not nil it is called when the process
+// starts and the function it returns is called when the process exits.
+func runCmdPrettyWatched(workDir string, stdin io.Reader, stdout io.Writer, watch func(p *os.Process) func(), name string, args ...string) error {
 
 	cmdLine := name
 	if filepath.IsAbs(name) {
@@ -40,14 +53,26 @@ func RunCmdPretty(workDir string, name string, args ...string) error {
 	L.Debug.Printf("Running \"%s\"\n", cmdLine)
 
 	cmd := exec.Command(name, args...)
-	cmd.Stdout = L.Writer
-	cmd.Stderr = L.Writer
-	cmd.Stdin = os.Stdin
+	if stdout == nil {
+		stdout = L.Writer
+	}
+	cmd.Stdout = stdout
+	cmd.Stderr = stdout
+	cmd.Stdin = stdin
 	cmd.Dir = workDir
 	addSysProcAttr(cmd)
 
 	L.Info.Println("---!--- Start of command output ---!---")
-	err := cmd.Run()
+	err := cmd.Start()
+	if err == nil {
+		if watch != nil {
+			stop := watch(cmd.Process)
+			err = cmd.Wait()
+			stop()
+		} else {
+			err = cmd.Wait()
+		}
+	}
 	L.Info.Println("---!--- End of command output ---!---")
 
 	if err != nil {
@@ -63,3 +88,78 @@ func RunCmdPretty(workDir string, name string, args ...string) error {
 	L.Ok.Println("Command exited with code 0")
 	return nil
 }
+
+// copyDir recursively copies src to dst, which must not exist
+func copyDir(src string, dst string) error {
+	return filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case info.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm())
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case info.Mode().IsRegular():
+			return copyFile(p, target, info.Mode().Perm())
+		}
+		return nil
+	})
+}
+
+func copyFile(src string, dst string, perm fs.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+
+	if _, err = io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// moveDir renames src to dst, falling back to a copy when they are on
+// different file systems
+func moveDir(src string, dst string) error {
+	err := os.Rename(src, dst)
+	if err == nil {
+		return nil
+	}
+
+	// Any other error, like an existing dst, must not be turned into a copy
+	// followed by the removal of src
+	if !isCrossDevice(err) {
+		return err
+	}
+
+	L.Debug.Printf("Unable to rename %s (%v), copying it instead\n", src, err)
+	if err = copyDir(src, dst); err != nil {
+		os.RemoveAll(dst)
+		return err
+	}
+	return os.RemoveAll(src)
+}
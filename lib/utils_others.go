@@ -3,7 +3,30 @@
 package lib
 
 import (
+	"errors"
+	"os"
 	"os/exec"
+	"syscall"
 )
 
 func addSysProcAttr(cmd *exec.Cmd) {}
+
+func processExists(pid int) bool {
+	return syscall.Kill(pid, 0) == nil
+}
+
+// requestThreadDump makes the JVM print the stack of its threads to stdout
+func requestThreadDump(p *os.Process) error {
+	return p.Signal(syscall.SIGQUIT)
+}
+
+// terminateProcess asks the process to exit, the JVM runs its shutdown hooks
+func terminateProcess(p *os.Process) error {
+	return p.Signal(syscall.SIGTERM)
+}
+
+// isCrossDevice reports whether a rename failed because src and dst are on
+// different file systems
+func isCrossDevice(err error) bool {
+	return errors.Is(err, syscall.EXDEV)
+}
@@ -3,6 +3,8 @@
 package lib
 
 import (
+	"errors"
+	"os"
 	"os/exec"
 	"syscall"
 )
@@ -10,3 +12,31 @@ import (
 func addSysProcAttr(cmd *exec.Cmd) {
 	cmd.SysProcAttr = &syscall.SysProcAttr{HideWindow: true}
 }
+
+func processExists(pid int) bool {
+	// On Windows FindProcess fails if the process does not exist
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	p.Release()
+	return true
+}
+
+func requestThreadDump(p *os.Process) error {
+	return errors.New("Thread dumps can only be requested with jcmd on Windows")
+}
+
+// terminateProcess kills the process since there are no signals on Windows
+func terminateProcess(p *os.Process) error {
+	return p.Kill()
+}
+
+// ERROR_NOT_SAME_DEVICE, returned when moving a file to another drive
+const errorNotSameDevice syscall.Errno = 17
+
+// isCrossDevice reports whether a rename failed because src and dst are on
+// different drives
+func isCrossDevice(err error) bool {
+	return errors.Is(err, errorNotSameDevice)
+}
@@ -0,0 +1,295 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	pingTimeout = 10 * time.Second
+	// Time the JVM has to exit after being asked to, then it is killed
+	terminateTimeout = 30 * time.Second
+	threadDumpFormat = "thread-dump-2006-01-02_15-04-05.txt"
+)
+
+var ErrServerHung = errors.New("The server stopped answering and was stopped by the watchdog")
+
+func writeVarInt(b *bytes.Buffer, value int32) {
+	v := uint32(value)
+	for v >= 0x80 {
+		b.WriteByte(byte(v) | 0x80)
+		v >>= 7
+	}
+	b.WriteByte(byte(v))
+}
+
+func readVarInt(r io.ByteReader) (int32, error) {
+	var v uint32
+	for i := 0; i < 5; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		v |= uint32(b&0x7f) << (7 * i)
+		if b&0x80 == 0 {
+			return int32(v), nil
+		}
+	}
+	return 0, errors.New("VarInt is too big")
+}
+
+func writePacket(w io.Writer, id int32, data []byte) error {
+	body := bytes.Buffer{}
+	writeVarInt(&body, id)
+	body.Write(data)
+
+	packet := bytes.Buffer{}
+	writeVarInt(&packet, int32(body.Len()))
+	packet.Write(body.Bytes())
+
+	_, err := w.Write(packet.Bytes())
+	return err
+}
+
+// ServerStatus is the answer to a status ping
+type ServerStatus struct {
+	Players struct {
+		Online int `json:"online"`
+		Max    int `json:"max"`
+	} `json:"players"`
+}
+
+// pingServer asks the status of the server like the multiplayer menu does,
+// a server whose tick loop is stuck does not answer
+func pingServer(host string, port uint16, timeout time.Duration) (*ServerStatus, error) {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, strconv.Itoa(int(port))), timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if err = conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+
+	// Handshake with protocol -1 and next state 1 (status), then the status
+	// request
+	handshake := bytes.Buffer{}
+	writeVarInt(&handshake, -1)
+	writeVarInt(&handshake, int32(len(host)))
+	handshake.WriteString(host)
+	_ = binary.Write(&handshake, binary.BigEndian, port)
+	writeVarInt(&handshake, 1)
+	if err = writePacket(conn, 0x00, handshake.Bytes()); err != nil {
+		return nil, err
+	}
+	if err = writePacket(conn, 0x00, nil); err != nil {
+		return nil, err
+	}
+
+	r := &byteReader{r: conn}
+	length, err := readVarInt(r)
+	if err != nil {
+		return nil, err
+	}
+	id, err := readVarInt(r)
+	if err != nil {
+		return nil, err
+	}
+	if length <= 1 || id != 0x00 {
+		return nil, fmt.Errorf("Unexpected status response (id %d, %d bytes)", id, length)
+	}
+
+	size, err := readVarInt(r)
+	if err != nil {
+		return nil, err
+	}
+	if size < 0 || size >= length {
+		return nil, fmt.Errorf("Invalid status response of %d bytes", size)
+	}
+	b := make([]byte, size)
+	if _, err = io.ReadFull(conn, b); err != nil {
+		return nil, err
+	}
+
+	status := &ServerStatus{}
+	if err = json.Unmarshal(b, status); err != nil {
+		return nil, fmt.Errorf("Invalid status response: %v", err)
+	}
+	return status, nil
+}
+
+type byteReader struct {
+	r io.Reader
+}
+
+func (r *byteReader) ReadByte() (byte, error) {
+	b := []byte{0}
+	_, err := io.ReadFull(r.r, b)
+	return b[0], err
+}
+
+// serverAddress returns the address the server listens on according to
+// server.properties
+func serverAddress(baseDir string) (string, uint16, bool) {
+	host, port := "127.0.0.1", uint16(DefaultServerPort)
+
+	props, err := LoadProperties(filepath.Join(baseDir, PropertiesFileName))
+	if err != nil {
+		return host, port, true
+	}
+	// The server listens on every interface if server-ip is not set
+	if ip := props.GetOr("server-ip", ""); ip != "" && !net.ParseIP(ip).IsUnspecified() {
+		host = ip
+	}
+	if p, err := strconv.ParseUint(props.GetOr("server-port", ""), 10, 16); err == nil {
+		port = uint16(p)
+	}
+	return host, port, props.GetOr("enable-status", "true") != "false"
+}
+
+type watchdog struct {
+	s    *Server
+	jcmd string
+	// Set to 1 when the watchdog stopped the server
+	fired  int32
+	exited chan struct{}
+}
+
+// newWatchdog returns nil if the watchdog is disabled or cannot work for the
+// server
+func newWatchdog(s *Server, java string) *watchdog {
+	if !C.Watchdog.Enable {
+		return nil
+	}
+	if C.Watchdog.Interval <= 0 || C.Watchdog.Failures == 0 {
+		L.Warn.Println("The watchdog is disabled since watchdog.interval or watchdog.failures is not set")
+		return nil
+	}
+	if _, _, statusEnabled := serverAddress(s.BaseDir); !statusEnabled {
+		L.Warn.Printf("The watchdog is disabled since enable-status is false in %s\n", PropertiesFileName)
+		return nil
+	}
+
+	jcmd := "jcmd"
+	if runtime.GOOS == "windows" {
+		jcmd += ".exe"
+	}
+	return &watchdog{
+		s:      s,
+		jcmd:   filepath.Join(filepath.Dir(java), jcmd),
+		exited: make(chan struct{}),
+	}
+}
+
+// Hung reports whether the watchdog stopped the server
+func (w *watchdog) Hung() bool {
+	return atomic.LoadInt32(&w.fired) == 1
+}
+
+// watch pings the server until it exits, it is meant to be passed to
+// runCmdPrettyWatched
+func (w *watchdog) watch(p *os.Process) func() {
+	go w.loop(p)
+	return func() { close(w.exited) }
+}
+
+func (w *watchdog) loop(p *os.Process) {
+	start := time.Now()
+	ticker := time.NewTicker(C.Watchdog.Interval)
+	defer ticker.Stop()
+
+	// The server does not answer until the world is loaded, failures are
+	// counted after the first answer or when the grace period is over
+	answered := false
+	failures := uint(0)
+	for {
+		select {
+		case <-w.exited:
+			return
+		case <-ticker.C:
+		}
+
+		// The port could have been changed while the server was running
+		host, port, _ := serverAddress(w.s.BaseDir)
+		_, err := pingServer(host, port, pingTimeout)
+		if err == nil {
+			if failures > 0 {
+				L.Info.Println("The server is answering again")
+			}
+			answered = true
+			failures = 0
+			continue
+		}
+
+		if !answered && time.Since(start) < C.Watchdog.StartupGrace {
+			L.Debug.Printf("The server is not answering yet: %v\n", err)
+			continue
+		}
+
+		failures++
+		L.Warn.Printf("The server did not answer the watchdog (%d/%d): %v\n", failures, C.Watchdog.Failures, err)
+		if failures >= C.Watchdog.Failures {
+			w.stop(p)
+			return
+		}
+	}
+}
+
+// threadDump saves the stack of the threads of the JVM in the logs folder,
+// or makes the JVM print it in the log if jcmd is not available
+func (w *watchdog) threadDump(p *os.Process) {
+	out, err := exec.Command(w.jcmd, strconv.Itoa(p.Pid), "Thread.print").Output()
+	if err == nil {
+		dir := filepath.Join(w.s.BaseDir, "logs")
+		path := filepath.Join(dir, time.Now().Format(threadDumpFormat))
+		if err = os.MkdirAll(dir, 0755); err == nil {
+			err = os.WriteFile(path, out, 0644)
+		}
+		if err == nil {
+			L.Info.Printf("Thread dump saved to %s\n", path)
+			return
+		}
+	}
+	L.Debug.Printf("Unable to use jcmd: %v\n", err)
+
+	if err = requestThreadDump(p); err != nil {
+		L.Warn.Printf("Unable to take a thread dump: %v\n", err)
+		return
+	}
+	L.Info.Println("The thread dump was printed in the log")
+	// Give the JVM the time to print it
+	time.Sleep(time.Second)
+}
+
+func (w *watchdog) stop(p *os.Process) {
+	L.Error.Printf("\"%s\" is not answering, it will be stopped\n", w.s.Name)
+	atomic.StoreInt32(&w.fired, 1)
+
+	w.threadDump(p)
+
+	if err := terminateProcess(p); err != nil {
+		L.Warn.Printf("Unable to stop the server: %v\n", err)
+	}
+	select {
+	case <-w.exited:
+		return
+	case <-time.After(terminateTimeout):
+	}
+
+	L.Warn.Println("The server did not exit, killing it")
+	if err := p.Kill(); err != nil {
+		L.Error.Printf("Unable to kill the server: %v\n", err)
+	}
+}